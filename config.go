@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+type configFile struct {
+	APIURL       string `yaml:"api_url"`
+	Token        string `yaml:"token"`
+	ProjectID    string `yaml:"project_id"`
+	TemplatesDir string `yaml:"templates_dir"`
+	JobName      string `yaml:"job_name"`
+}
+
+func loadConfigFile(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config configFile
+	err = yaml.UnmarshalStrict(contents, &config)
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	ciAPIV4URL = config.APIURL
+	gitlabAPIToken = config.Token
+	ciProjectID = config.ProjectID
+	ciProjectDir = dir
+	ciJobName = config.JobName
+
+	if config.TemplatesDir != "" {
+		issuesRelativePath = config.TemplatesDir
+	}
+
+	return nil
+}
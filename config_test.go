@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_loadConfigFile(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"config.yaml": `api_url: "https://gitlab.example.com/api/v4"
+token: "file-token"
+project_id: "group/project"
+templates_dir: "templates"
+job_name: "recurring issues"
+`,
+		"invalid.yaml": `unknown: true
+`,
+	})
+
+	setEnv(t, map[string]string{
+		"GITLAB_API_TOKEN": "env-token",
+		"CI_API_V4_URL":    "",
+		"CI_PROJECT_ID":    "",
+		"CI_PROJECT_DIR":   "",
+		"CI_JOB_NAME":      "",
+	})
+	clearConfig(t)
+
+	err := loadConfigFile(filepath.Join(dir, "invalid.yaml"))
+	if err == nil {
+		t.Errorf("loadConfigFile() error = nil, want error for unknown key")
+	}
+
+	err = loadConfigFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = loadEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{ciAPIV4URL, gitlabAPIToken, ciProjectID, ciProjectDir, ciJobName, issuesRelativePath}
+	want := []string{"https://gitlab.example.com/api/v4", "env-token", "group/project", dir, "recurring issues", "templates"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("loadConfigFile() = %v, want %v", got, want)
+			break
+		}
+	}
+}
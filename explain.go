@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+func runExplain(projectDir string, name string) int {
+	dir, err := resolveTemplatesDir(projectDir, issuesRelativePath)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	issuesRelativePath = dir
+
+	confidential, err := getBoolEnv("DEFAULT_CONFIDENTIAL")
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	data, err := explainTemplate(dir, name, confidential, os.Getenv("DEFAULT_ASSIGNEE"))
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	err = writeExplanation(os.Stdout, data)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	return exitOK
+}
+
+// explainTemplate loads a template and applies the directory and environment
+// defaults that would be used when creating its issues.
+func explainTemplate(dir string, name string, confidential bool, assignee string) (*metadata, error) {
+	if filepath.Ext(name) != ".md" {
+		name += ".md"
+	}
+
+	path, err := resolveTemplatePath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := loadTemplate(path, newDefaultsLoader())
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadDescriptionFile(data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Confidential == nil {
+		data.Confidential = &confidential
+	}
+
+	if len(data.Assignees) == 0 && assignee != "" {
+		data.Assignees = []string{assignee}
+	}
+
+	if data.Timezone == "" {
+		data.Timezone = "UTC"
+	}
+
+	return data, nil
+}
+
+func writeExplanation(w io.Writer, data *metadata) error {
+	fields, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var output bytes.Buffer
+	output.WriteString("---\n")
+	output.Write(fields)
+	fmt.Fprintf(&output, "---\n%s", data.Description)
+	if data.Description != "" && !strings.HasSuffix(data.Description, "\n") {
+		output.WriteString("\n")
+	}
+
+	_, err = w.Write(output.Bytes())
+	return err
+}
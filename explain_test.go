@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_explainTemplate(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"team/_defaults.yaml": `labels: ["team"]
+timezone: "Europe/London"
+`,
+		"team/weekly.md": `---
+title: Weekly
+crontab: "0 9 * * 1"
+---
+Weekly checklist
+`,
+		"assigned.md": `---
+title: Assigned
+assignees: ["user1"]
+confidential: false
+---
+`,
+	})
+
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = dir
+
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "Applies directory and environment defaults",
+			template: "team/weekly",
+			want: []string{
+				"---\ntitle: Weekly\n",
+				"confidential: true\n",
+				"assignees: [oncall-bot]\n",
+				"labels: [team]\n",
+				"timezone: Europe/London\n",
+				"---\nWeekly checklist\n",
+			},
+		},
+		{
+			name:     "Prefers template values over defaults",
+			template: "assigned.md",
+			want: []string{
+				"confidential: false\n",
+				"assignees: [user1]\n",
+				"timezone: UTC\n",
+			},
+		},
+		{name: "Rejects unknown template", template: "missing", wantErr: true},
+		{name: "Rejects template outside the templates directory", template: "../secret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := explainTemplate(dir, tt.template, true, "oncall-bot")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("explainTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var output bytes.Buffer
+			err = writeExplanation(&output, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("writeExplanation() = %q, want it to contain %q", output.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ module github.com/ph1ll/gitlab-recurring-issues
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/ericaro/frontmatter v0.0.0-20200210094738-46863cd917e2
 	github.com/gorhill/cronexpr v0.0.0-20180427100037-88b0669f7d75
 	github.com/xanzy/go-gitlab v0.33.0
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+func runPostHook(command string, summary *runSummary) (string, error) {
+	contents, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(command)
+	cmd.Stdin = bytes.NewReader(contents)
+
+	output, err := cmd.CombinedOutput()
+
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_runPostHook(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Passes the summary on stdin", script: "#!/bin/sh\ncat\n", want: `{"templates_scanned":1,"created":[],"skipped":[],"errors":[]}`},
+		{name: "Reports a non-zero exit", script: "#!/bin/sh\necho failed\nexit 3\n", want: "failed", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := filepath.Join(writeTemplates(t, map[string]string{"hook.sh": tt.script}), "hook.sh")
+			err := os.Chmod(hook, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			summary := newRunSummary()
+			summary.TemplatesScanned = 1
+
+			got, err := runPostHook(hook, summary)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runPostHook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("runPostHook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// instanceClients holds a client for each secondary GitLab instance named by
+// a template's instance field. Each instance is connected and its token
+// checked once per run; a failure is remembered so that only the templates
+// for that instance fail.
+type instanceClients struct {
+	connect func(name string) (*client, error)
+	clients map[string]*client
+	errors  map[string]error
+	mutex   sync.Mutex
+}
+
+func newInstanceClients() *instanceClients {
+	return &instanceClients{
+		connect: connectInstance,
+		clients: make(map[string]*client),
+		errors:  make(map[string]error),
+	}
+}
+
+func (c *instanceClients) get(name string) (*client, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if git, ok := c.clients[name]; ok {
+		return git, nil
+	}
+
+	if err, ok := c.errors[name]; ok {
+		return nil, err
+	}
+
+	git, err := c.connect(name)
+	if err != nil {
+		err = fmt.Errorf("instance %q: %w", name, err)
+		c.errors[name] = err
+		return nil, err
+	}
+
+	c.clients[name] = git
+	return git, nil
+}
+
+// forInstance returns the client to create a template's issues with: this
+// client, or one for the secondary instance the template names.
+func (git *client) forInstance(data *metadata) (*client, error) {
+	if data.Instance == "" {
+		return git, nil
+	}
+
+	if data.Project == "" {
+		return nil, fmt.Errorf("instance %q requires project to be set", data.Instance)
+	}
+
+	return git.instances.get(data.Instance)
+}
+
+// instanceVariable returns the name of the environment variable holding a
+// setting for the named instance, e.g. GITLAB_INSTANCE_MIRROR_URL.
+func instanceVariable(name, setting string) string {
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+
+	return "GITLAB_INSTANCE_" + key + "_" + setting
+}
+
+func connectInstance(name string) (*client, error) {
+	urlVariable := instanceVariable(name, "URL")
+	tokenVariable := instanceVariable(name, "TOKEN")
+
+	url := os.Getenv(urlVariable)
+	token := os.Getenv(tokenVariable)
+	if url == "" || token == "" {
+		return nil, fmt.Errorf("environment variables '%s' and '%s' must be set", urlVariable, tokenVariable)
+	}
+
+	git, err := gitlab.NewClient(token, gitlab.WithBaseURL(url), gitlab.WithHTTPClient(newHTTPClient()), gitlab.WithoutRetries())
+	if err != nil {
+		return nil, err
+	}
+
+	instance := newClient(git)
+
+	err = checkToken(instance, tokenVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
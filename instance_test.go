@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_instanceVariable(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance string
+		setting  string
+		want     string
+	}{
+		{name: "Upper-cases the instance name", instance: "mirror", setting: "URL", want: "GITLAB_INSTANCE_MIRROR_URL"},
+		{name: "Replaces characters not allowed in variable names", instance: "gitlab.example-2", setting: "TOKEN", want: "GITLAB_INSTANCE_GITLAB_EXAMPLE_2_TOKEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := instanceVariable(tt.instance, tt.setting); got != tt.want {
+				t.Errorf("instanceVariable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_instanceClients_get(t *testing.T) {
+	connects := 0
+
+	instances := newInstanceClients()
+	instances.connect = func(name string) (*client, error) {
+		connects++
+		if name == "broken" {
+			return nil, errors.New("token was rejected")
+		}
+		return &client{}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := instances.get("mirror")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = instances.get("broken")
+		if err == nil || !strings.Contains(err.Error(), `instance "broken"`) {
+			t.Errorf("get() error = %v, want an error naming the instance", err)
+		}
+	}
+
+	if connects != 2 {
+		t.Errorf("get() connected %v times, want once per instance", connects)
+	}
+}
+
+func Test_createIssue_instance(t *testing.T) {
+	primary := http.NewServeMux()
+	primary.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("createIssue() requested %v from the primary instance", r.URL.Path)
+	})
+	git := newTestClient(t, primary)
+
+	created := 0
+
+	mirror := http.NewServeMux()
+	mirror.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "mirror-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"401 Unauthorized"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":1,"username":"bot"}`)
+	})
+	mirror.HandleFunc("/api/v4/personal_access_tokens/self", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"scopes":["api"]}`)
+	})
+	mirror.HandleFunc("/api/v4/projects/group/project", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":5}`)
+	})
+	mirror.HandleFunc("/api/v4/projects/5/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			created++
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	server := httptest.NewServer(mirror)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		data    *metadata
+		token   string
+		want    int
+		wantErr string
+	}{
+		{name: "Creates the issue on the named instance", data: &metadata{Title: "Mirrored", Instance: "mirror", Project: "group/project"}, token: "mirror-token", want: 1},
+		{name: "Reports a rejected token for the instance", data: &metadata{Title: "Mirrored", Instance: "mirror", Project: "group/project"}, token: "expired", wantErr: "GITLAB_INSTANCE_MIRROR_TOKEN was rejected"},
+		{name: "Requires the instance to be configured", data: &metadata{Title: "Mirrored", Instance: "other", Project: "group/project"}, token: "mirror-token", wantErr: "GITLAB_INSTANCE_OTHER_URL"},
+		{name: "Requires a project on the instance", data: &metadata{Title: "Mirrored", Instance: "mirror"}, token: "mirror-token", wantErr: "requires project"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, map[string]string{
+				"GITLAB_INSTANCE_MIRROR_URL":   server.URL,
+				"GITLAB_INSTANCE_MIRROR_TOKEN": tt.token,
+			})
+			git.instances = newInstanceClients()
+			created = 0
+
+			_, err := createIssue(git, tt.data)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("createIssue() error = %v, want mention of %v", err, tt.wantErr)
+			}
+			if created != tt.want {
+				t.Errorf("createIssue() created = %v, want %v", created, tt.want)
+			}
+		})
+	}
+}
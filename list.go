@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type templateListing struct {
+	Template  string     `json:"template"`
+	Title     string     `json:"title"`
+	Crontab   []string   `json:"crontab"`
+	NextTime  *time.Time `json:"next_time,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	Labels    []string   `json:"labels"`
+	Assignees []string   `json:"assignees"`
+	Error     string     `json:"error,omitempty"`
+}
+
+func runListTemplates(projectDir string, asJSON bool) int {
+	dir, err := resolveTemplatesDir(projectDir, issuesRelativePath)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	issuesRelativePath = dir
+
+	listings, err := listTemplates(dir, time.Now())
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	if asJSON {
+		err = writeListingsJSON(os.Stdout, listings)
+	} else {
+		err = writeListingsTable(os.Stdout, listings)
+	}
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	return exitOK
+}
+
+func listTemplates(dir string, from time.Time) ([]templateListing, error) {
+	listings := []templateListing{}
+	defaults := newDefaultsLoader()
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		listing := templateListing{Template: templateName(path), Crontab: []string{}, Labels: []string{}, Assignees: []string{}}
+
+		data, err := loadTemplate(path, defaults)
+		if err != nil {
+			listing.Error = err.Error()
+			listings = append(listings, listing)
+			return nil
+		}
+
+		listing.Title = data.Title
+		listing.Enabled = boolValue(data.Enabled, true)
+		listing.Crontab = append(listing.Crontab, data.Crontab...)
+		listing.Labels = append(listing.Labels, data.Labels...)
+		listing.Assignees = append(listing.Assignees, data.Assignees...)
+
+		if len(data.Crontab) > 0 {
+			err = scheduleIssue(data, from)
+			if err != nil {
+				listing.Error = err.Error()
+			} else {
+				listing.NextTime = timePointer(data.NextTime)
+			}
+		}
+
+		listings = append(listings, listing)
+		return nil
+	})
+
+	return listings, err
+}
+
+func writeListingsJSON(w io.Writer, listings []templateListing) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(listings)
+}
+
+func writeListingsTable(w io.Writer, listings []templateListing) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "TEMPLATE\tTITLE\tCRONTAB\tNEXT\tLABELS\tASSIGNEES")
+	for _, listing := range listings {
+		next := "once"
+		switch {
+		case listing.Error != "":
+			next = "error: " + listing.Error
+		case !listing.Enabled:
+			next = "disabled"
+		case listing.NextTime != nil:
+			next = listing.NextTime.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			listing.Template,
+			listing.Title,
+			listValue(listing.Crontab),
+			next,
+			listValue(listing.Labels),
+			listValue(listing.Assignees),
+		)
+	}
+
+	return table.Flush()
+}
+
+func listValue(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	return strings.Join(values, ", ")
+}
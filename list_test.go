@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_listTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"daily.md": `---
+title: Daily
+crontab: "0 9 * * *"
+labels: ["chore"]
+assignees: ["user1"]
+---
+`,
+		"disabled.md": `---
+title: Disabled
+crontab: "@daily"
+enabled: false
+---
+`,
+		"invalid.md": `---
+title: Invalid
+crontab: "not a crontab"
+---
+`,
+		"oneshot.md": `---
+title: One-shot
+---
+`,
+	})
+
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = dir
+
+	listings, err := listTemplates(dir, time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var table bytes.Buffer
+	err = writeListingsTable(&table, listings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTable := `TEMPLATE  TITLE     CRONTAB        NEXT                                                        LABELS  ASSIGNEES
+daily     Daily     0 9 * * *      2020-01-16T09:00:00Z                                        chore   user1
+disabled  Disabled  @daily         disabled                                                    -       -
+invalid   Invalid   not a crontab  error: expected 5 fields, or 6 with leading seconds, got 3  -       -
+oneshot   One-shot  -              once                                                        -       -
+`
+	if table.String() != wantTable {
+		t.Errorf("writeListingsTable() = \n%v, want \n%v", table.String(), wantTable)
+	}
+
+	var output bytes.Buffer
+	err = writeListingsJSON(&output, listings[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantJSON := `[
+  {
+    "template": "daily",
+    "title": "Daily",
+    "crontab": [
+      "0 9 * * *"
+    ],
+    "next_time": "2020-01-16T09:00:00Z",
+    "enabled": true,
+    "labels": [
+      "chore"
+    ],
+    "assignees": [
+      "user1"
+    ]
+  }
+]
+`
+	if output.String() != wantJSON {
+		t.Errorf("writeListingsJSON() = %v, want %v", output.String(), wantJSON)
+	}
+}
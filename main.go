@@ -1,215 +1,3197 @@
-package main
-
-import (
-	"crypto/tls"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
-	"path"
-	"path/filepath"
-	"time"
-
-	"github.com/ericaro/frontmatter"
-	"github.com/gorhill/cronexpr"
-	"github.com/xanzy/go-gitlab"
-)
-
-var (
-	ciAPIV4URL         string = ""
-	gitlabAPIToken     string = ""
-	ciProjectID        string = ""
-	ciProjectDir       string = ""
-	ciJobName          string = ""
-	issuesRelativePath string = ".gitlab/recurring_issue_templates/"
-)
-
-type metadata struct {
-	Title        string   `yaml:"title"`
-	Description  string   `fm:"content" yaml:"-"`
-	Confidential bool     `yaml:"confidential"`
-	Assignees    []string `yaml:"assignees,flow"`
-	Labels       []string `yaml:"labels,flow"`
-	DueIn        string   `yaml:"duein"`
-	Crontab      string   `yaml:"crontab"`
-	NextTime     time.Time
-}
-
-func processIssueFile(lastTime time.Time) filepath.WalkFunc {
-	return func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if filepath.Ext(path) != ".md" {
-			return nil
-		}
-
-		contents, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-
-		data, err := parseMetadata(contents)
-		if err != nil {
-			return err
-		}
-
-		cronExpression, err := cronexpr.Parse(data.Crontab)
-		if err != nil {
-			return err
-		}
-
-		data.NextTime = cronExpression.Next(lastTime)
-
-		if data.NextTime.Before(time.Now()) {
-			log.Println(path, "was due", data.NextTime.Format(time.RFC3339), "- creating new issue")
-
-			err := createIssue(data)
-			if err != nil {
-				return err
-			}
-		} else {
-			log.Println(path, "is due", data.NextTime.Format(time.RFC3339))
-		}
-
-		return nil
-	}
-}
-
-func parseMetadata(contents []byte) (*metadata, error) {
-	data := new(metadata)
-	err := frontmatter.Unmarshal(contents, data)
-	if err != nil {
-		return nil, err
-	}
-
-	return data, nil
-}
-
-func createIssue(data *metadata) error {
-	transCfg := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	httpClient := &http.Client{
-		Transport: transCfg,
-	}
-
-	git, err := gitlab.NewClient(gitlabAPIToken, gitlab.WithBaseURL(ciAPIV4URL), gitlab.WithHTTPClient(httpClient))
-	if err != nil {
-		return err
-	}
-
-	project, _, err := git.Projects.GetProject(ciProjectID, nil)
-	if err != nil {
-		return err
-	}
-
-	options := &gitlab.CreateIssueOptions{
-		Title:        gitlab.String(data.Title),
-		Description:  gitlab.String(data.Description),
-		Confidential: &data.Confidential,
-		CreatedAt:    &data.NextTime,
-	}
-
-	if data.DueIn != "" {
-		duration, err := time.ParseDuration(data.DueIn)
-		if err != nil {
-			return err
-		}
-
-		dueDate := gitlab.ISOTime(data.NextTime.Add(duration))
-
-		options.DueDate = &dueDate
-	}
-
-	_, _, err = git.Issues.CreateIssue(project.ID, options)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func getLastRunTime() (time.Time, error) {
-	transCfg := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	httpClient := &http.Client{
-		Transport: transCfg,
-	}
-
-	git, err := gitlab.NewClient(gitlabAPIToken, gitlab.WithBaseURL(ciAPIV4URL), gitlab.WithHTTPClient(httpClient))
-	if err != nil {
-		return time.Unix(0, 0), err
-	}
-
-	options := &gitlab.ListProjectPipelinesOptions{
-		Scope:   gitlab.String("finished"),
-		Status:  gitlab.BuildState(gitlab.Success),
-		OrderBy: gitlab.String("updated_at"),
-	}
-
-	pipelineInfos, _, err := git.Pipelines.ListProjectPipelines(ciProjectID, options)
-	if err != nil {
-		return time.Unix(0, 0), err
-	}
-
-	for _, pipelineInfo := range pipelineInfos {
-		jobs, _, err := git.Jobs.ListPipelineJobs(ciProjectID, pipelineInfo.ID, nil)
-		if err != nil {
-			return time.Unix(0, 0), err
-		}
-
-		for _, job := range jobs {
-			if job.Name == ciJobName {
-				return *job.FinishedAt, nil
-			}
-		}
-	}
-
-	return time.Unix(0, 0), nil
-}
-
-func main() {
-	gitlabAPIToken = os.Getenv("GITLAB_API_TOKEN")
-	if gitlabAPIToken == "" {
-		log.Fatal("Environment variable 'GITLAB_API_TOKEN' not found. Ensure this is set under the project CI/CD settings.")
-	}
-
-	ciAPIV4URL = os.Getenv("CI_API_V4_URL")
-	if ciAPIV4URL == "" {
-		log.Fatal("Environment variable 'CI_API_V4_URL' not found. This tool must be ran as part of a GitLab pipeline.")
-	}
-
-	ciProjectID = os.Getenv("CI_PROJECT_ID")
-	if gitlabAPIToken == "" {
-		log.Fatal("Environment variable 'CI_PROJECT_ID' not found. This tool must be ran as part of a GitLab pipeline.")
-	}
-
-	ciProjectDir = os.Getenv("CI_PROJECT_DIR")
-	if gitlabAPIToken == "" {
-		log.Fatal("Environment variable 'CI_PROJECT_DIR' not found. This tool must be ran as part of a GitLab pipeline.")
-	}
-
-	ciJobName = os.Getenv("CI_JOB_NAME")
-	if gitlabAPIToken == "" {
-		log.Fatal("Environment variable 'CI_JOB_NAME' not found. This tool must be ran as part of a GitLab pipeline.")
-	}
-
-	issuesRelativePath = path.Join(ciProjectDir, issuesRelativePath)
-
-	lastRunTime, err := getLastRunTime()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Println("Last run:", lastRunTime.Format(time.RFC3339))
-
-	err = filepath.Walk(issuesRelativePath, processIssueFile(lastRunTime))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Println("Run complete")
-}
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ericaro/frontmatter"
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ciAPIV4URL          string          = ""
+	gitlabAPIToken      string          = ""
+	ciProjectID         string          = ""
+	ciProjectDir        string          = ""
+	ciJobName           string          = ""
+	gitlabInsecureTLS   bool            = false
+	dryRun              bool            = false
+	defaultConfidential bool            = false
+	catchUp             bool            = false
+	maxBackfill         int             = 10
+	summaryFile         string          = ""
+	maxRetries          int             = 3
+	retryDelay          time.Duration   = time.Second
+	createLabels        bool            = false
+	labelColor          string          = "#6699cc"
+	force               bool            = false
+	defaultAssignee     string          = ""
+	triageProject       string          = "triage"
+	stateBackend        string          = "pipeline"
+	stateFile           string          = "recurring_issues_state.json"
+	firstRun            string          = "schedule"
+	appendFooter        bool            = false
+	rateLimit           int             = 0
+	notifyWebhookURL    string          = ""
+	holidays            map[string]bool = nil
+	createdAtMode       string          = "occurrence"
+	postHook            string          = ""
+	concurrency         int             = 4
+	validateAssignees   bool            = false
+	fiscalYearStart     int             = 1
+	linkPrevious        bool            = false
+	expandEnv           bool            = false
+	closePrevious       bool            = false
+	rollWeekendDue      bool            = false
+	pushgatewayURL      string          = ""
+	templatesSource     string          = "filesystem"
+	templatesRef        string          = ""
+	strict              bool            = false
+	includeRoot         string          = "templates"
+	onCallRotation      *rotation       = nil
+	artifactPath        string          = "created_issues.json"
+	gracePeriod         time.Duration   = 0
+	pipelineRef         string          = ""
+	biweeklyAnchor      time.Time       = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+	maxDescriptionBytes int             = 1048576
+	issuesRelativePath  string          = ".gitlab/recurring_issue_templates/"
+)
+
+var (
+	errUserNotFound   = errors.New("user not found")
+	errDuplicateIssue = errors.New("duplicate issue")
+	errMaxOccurrences = errors.New("maximum occurrences reached")
+	errNoIterations   = errors.New("iterations are not available")
+	errPrecondition   = errors.New("precondition not met")
+)
+
+type client struct {
+	*gitlab.Client
+	users     *userResolver
+	projects  *projectCache
+	instances *instanceClients
+}
+
+func newClient(git *gitlab.Client) *client {
+	return &client{
+		Client:    git,
+		users:     newUserResolver(git),
+		projects:  newProjectCache(git),
+		instances: newInstanceClients(),
+	}
+}
+
+type userResolver struct {
+	lookup func(username string) (int, error)
+	cache  map[string]int
+	mutex  sync.Mutex
+}
+
+func newUserResolver(git *gitlab.Client) *userResolver {
+	return &userResolver{
+		lookup: func(username string) (int, error) {
+			var users []*gitlab.User
+			err := withRetry(func() (resp *gitlab.Response, err error) {
+				users, resp, err = git.Users.ListUsers(&gitlab.ListUsersOptions{Username: gitlab.String(username)})
+				return resp, err
+			})
+			if err != nil {
+				return 0, err
+			}
+
+			if len(users) == 0 {
+				return 0, errUserNotFound
+			}
+
+			return users[0].ID, nil
+		},
+		cache: make(map[string]int),
+	}
+}
+
+func (r *userResolver) resolve(username string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if id, ok := r.cache[username]; ok {
+		if id == 0 {
+			return 0, errUserNotFound
+		}
+
+		return id, nil
+	}
+
+	id, err := r.lookup(username)
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		return 0, err
+	}
+
+	r.cache[username] = id
+
+	return id, err
+}
+
+const (
+	exitOK              = 0
+	exitTemplatesFailed = 2
+	exitConfigError     = 3
+)
+
+const defaultsFileName = "_defaults.yaml"
+
+const tomlDelimiter = "+++\n"
+
+var issueTypes = []string{"issue", "incident", "task"}
+
+var healthStatuses = []string{"on_track", "needs_attention", "at_risk"}
+
+var assigneeStrategies = []string{"round-robin"}
+
+type createIssueOptions struct {
+	*gitlab.CreateIssueOptions
+	IssueType *string `json:"issue_type,omitempty"`
+}
+
+type templateVariables struct {
+	NextTime time.Time
+	Date     string
+	Year     int
+	Month    time.Month
+	Week     int
+}
+
+type crontabs []string
+
+func (c *crontabs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*c = crontabs{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := unmarshal(&multiple); err != nil {
+		return err
+	}
+
+	*c = multiple
+	return nil
+}
+
+type metadata struct {
+	Title              string      `yaml:"title"`
+	AppendDate         *bool       `yaml:"append_date"`
+	DateFormat         string      `yaml:"date_format"`
+	Description        string      `fm:"content" yaml:"-"`
+	DescriptionFile    string      `yaml:"descriptionfile"`
+	Confidential       *bool       `yaml:"confidential"`
+	Assignees          []string    `yaml:"assignees,flow"`
+	AssigneeStrategy   string      `yaml:"assignee_strategy"`
+	AssigneePool       []string    `yaml:"assignee_pool,flow"`
+	Labels             []string    `yaml:"labels,flow"`
+	Mentions           []string    `yaml:"mentions,flow"`
+	Subscribers        []string    `yaml:"subscribers,flow"`
+	Project            string      `yaml:"project"`
+	Instance           string      `yaml:"instance"`
+	Group              string      `yaml:"group"`
+	Author             string      `yaml:"author"`
+	Milestone          string      `yaml:"milestone"`
+	Epic               string      `yaml:"epic"`
+	Iteration          string      `yaml:"iteration"`
+	Weight             *int        `yaml:"weight"`
+	IssueType          string      `yaml:"issuetype"`
+	HealthStatus       string      `yaml:"healthstatus"`
+	Estimate           string      `yaml:"estimate"`
+	DueIn              string      `yaml:"duein"`
+	DueDate            string      `yaml:"duedate"`
+	DueTime            *bool       `yaml:"duetime"`
+	Crontab            crontabs    `yaml:"crontab"`
+	Jitter             string      `yaml:"jitter"`
+	Timezone           string      `yaml:"timezone"`
+	StartDate          string      `yaml:"startdate"`
+	EndDate            string      `yaml:"enddate"`
+	MaxOccurrences     int         `yaml:"maxoccurrences"`
+	CarryOver          *bool       `yaml:"carryover"`
+	UseTemplate        string      `yaml:"usetemplate"`
+	QuickActions       *bool       `yaml:"quickactions"`
+	Blocks             int         `yaml:"blocks"`
+	BlockedBy          int         `yaml:"blockedby"`
+	PreconditionURL    string      `yaml:"precondition_url"`
+	PreconditionStatus int         `yaml:"precondition_status"`
+	Enabled            *bool       `yaml:"enabled"`
+	Template           string      `yaml:"-"`
+	Warnings           *warningLog `yaml:"-"`
+	NextTime           time.Time   `yaml:"-"`
+	PeriodEnd          time.Time   `yaml:"-"`
+}
+
+// warningLog collects the non-fatal problems hit while creating an issue, so
+// that STRICT can report them as failures. A nil log only prints warnings.
+type warningLog struct {
+	messages []string
+}
+
+func (w *warningLog) warn(v ...interface{}) {
+	message := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	log.Println("Warning: " + message)
+
+	if w != nil {
+		w.messages = append(w.messages, message)
+	}
+}
+
+func (w *warningLog) reset() []string {
+	if w == nil {
+		return nil
+	}
+
+	messages := w.messages
+	w.messages = nil
+	return messages
+}
+
+// projectCache remembers each project fetched during a run, as most
+// templates create issues in the same few projects.
+type projectCache struct {
+	lookup   func(id string) (*gitlab.Project, *gitlab.Response, error)
+	projects map[string]*gitlab.Project
+	mutex    sync.Mutex
+}
+
+func newProjectCache(git *gitlab.Client) *projectCache {
+	return &projectCache{
+		lookup: func(id string) (*gitlab.Project, *gitlab.Response, error) {
+			var project *gitlab.Project
+			var resp *gitlab.Response
+			err := withRetry(func() (*gitlab.Response, error) {
+				var err error
+				project, resp, err = git.Projects.GetProject(id, nil)
+				return resp, err
+			})
+			return project, resp, err
+		},
+		projects: make(map[string]*gitlab.Project),
+	}
+}
+
+func (c *projectCache) get(id string) (*gitlab.Project, *gitlab.Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if project, ok := c.projects[id]; ok {
+		return project, nil, nil
+	}
+
+	project, resp, err := c.lookup(id)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	c.projects[id] = project
+
+	return project, resp, nil
+}
+
+type defaultsLoader struct {
+	cache map[string]*metadata
+	mutex sync.Mutex
+}
+
+func newDefaultsLoader() *defaultsLoader {
+	return &defaultsLoader{cache: make(map[string]*metadata)}
+}
+
+func (l *defaultsLoader) load(dir string) (*metadata, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if defaults, ok := l.cache[dir]; ok {
+		return defaults, nil
+	}
+
+	defaults := new(metadata)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, defaultsFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(contents, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", defaultsFileName, err)
+	}
+
+	l.cache[dir] = defaults
+	return defaults, nil
+}
+
+func mergeDefaults(data *metadata, defaults *metadata) {
+	target := reflect.ValueOf(data).Elem()
+	source := reflect.ValueOf(defaults).Elem()
+
+	for i := 0; i < target.NumField(); i++ {
+		if target.Field(i).IsZero() {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+}
+
+func findTemplates(paths *[]string, summary *runSummary) filepath.WalkFunc {
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Println("Error:", fmt.Errorf("%s: %w", path, err))
+			summary.failed(path, err)
+			return nil
+		}
+
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		*paths = append(*paths, path)
+		return nil
+	}
+}
+
+func processTemplates(git *client, dir string, state *runState, summary *runSummary) error {
+	var paths []string
+
+	err := filepath.Walk(dir, findTemplates(&paths, summary))
+	if err != nil {
+		return err
+	}
+
+	summary.TemplatesScanned += len(paths)
+
+	defaults := newDefaultsLoader()
+	runTime := time.Now()
+
+	// Each template gets its own summary so results can be merged in walk order once all workers finish
+	results := make([]*runSummary, len(paths))
+	succeeded := make([]bool, len(paths))
+	jobs := make(chan int)
+
+	workers := concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				path := paths[job]
+				results[job] = newRunSummary()
+
+				err := processTemplate(git, state.lastRunTime(templateName(path)), path, defaults, results[job])
+				if err != nil {
+					log.Println("Error:", fmt.Errorf("%s: %w", path, err))
+					results[job].failed(path, err)
+					continue
+				}
+
+				succeeded[job] = true
+			}
+		}()
+	}
+
+	for job := range paths {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	for job, path := range paths {
+		summary.merge(results[job])
+
+		if succeeded[job] {
+			state.recordRun(templateName(path), runTime)
+		}
+	}
+
+	return nil
+}
+
+func loadTemplate(path string, defaults *defaultsLoader) (*metadata, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := parseMetadata(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown, err := unknownKeys(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unknown) > 0 {
+		if strict {
+			return nil, fmt.Errorf("unknown front matter key(s): %s", strings.Join(unknown, ", "))
+		}
+		log.Println("Warning:", path, "has unknown front matter key(s)", strings.Join(unknown, ", "), "- ignoring")
+	}
+
+	directoryDefaults, err := defaults.load(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	mergeDefaults(data, directoryDefaults)
+
+	data.Template = templateName(path)
+
+	return data, nil
+}
+
+func processTemplate(git *client, lastTime time.Time, path string, defaults *defaultsLoader, summary *runSummary) error {
+	data, err := loadTemplate(path, defaults)
+	if err != nil {
+		return err
+	}
+
+	data.Warnings = &warningLog{}
+
+	if !boolValue(data.Enabled, true) {
+		log.Println(path, "is disabled - skipping")
+		summary.skipped(path, time.Time{}, "disabled")
+		return nil
+	}
+
+	err = loadDescriptionFile(data, path)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Crontab) == 0 {
+		return processOneShot(git, path, data, summary)
+	}
+
+	// FIRST_RUN=create forces the next occurrence on a first run, the same way
+	// FORCE does, rather than creating one dated at the epoch.
+	forced := force
+
+	if lastTime.Equal(time.Unix(0, 0)) {
+		switch firstRun {
+		case "skip":
+			if force {
+				log.Println(path, "has no previous run - scheduling from now and forcing creation")
+				lastTime = time.Now()
+				break
+			}
+
+			log.Println(path, "has no previous run - skipping")
+			summary.skipped(path, time.Time{}, "first run")
+			return nil
+		case "schedule":
+			log.Println(path, "has no previous run - scheduling from now")
+			lastTime = time.Now()
+		case "create":
+			log.Println(path, "has no previous run - scheduling from now and forcing creation")
+			lastTime = time.Now()
+			forced = true
+		}
+	}
+
+	err = scheduleIssue(data, lastTime)
+	if err != nil {
+		return err
+	}
+
+	// Before creating anything, schedule from the most recent issue created
+	// from this template if it is later than the last run, so a rerun within
+	// the same window does not create the occurrence again.
+	if isDue(data.NextTime) {
+		lastCreated, err := lastCreatedTime(git, data)
+		if err != nil {
+			return err
+		}
+
+		if lastCreated.After(lastTime) {
+			log.Println(path, "last created an issue at", lastCreated.Format(time.RFC3339), "- scheduling from then")
+
+			err = scheduleIssue(data, lastCreated)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	expired, err := afterEndDate(data, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if expired {
+		log.Println(path, "expired on", data.EndDate, "- skipping")
+		summary.skipped(path, time.Time{}, "expired")
+		return nil
+	}
+
+	beforeStart, err := beforeStartDate(data)
+	if err != nil {
+		return err
+	}
+
+	if beforeStart {
+		log.Println(path, "is due", data.NextTime.Format(time.RFC3339), "before its start date", data.StartDate, "- skipping")
+		summary.skipped(path, data.NextTime, "before start date")
+		return nil
+	}
+
+	if !isDue(data.NextTime) {
+		if !forced {
+			log.Println(path, "is due", data.NextTime.Format(time.RFC3339))
+			summary.skipped(path, data.NextTime, "not due")
+			return nil
+		}
+
+		log.Println(path, "is due", data.NextTime.Format(time.RFC3339), "- forcing creation")
+	}
+
+	occurrences := 1
+	if catchUp {
+		occurrences = maxBackfill
+	}
+
+	for i := 0; i < occurrences && (i == 0 || isDue(data.NextTime)); i++ {
+		log.Println(path, "was due", data.NextTime.Format(time.RFC3339), "- creating new issue")
+
+		issue, err := createIssue(git, data)
+		if errors.Is(err, errMaxOccurrences) {
+			summary.skipped(path, data.NextTime, "maximum occurrences reached")
+			return nil
+		} else if errors.Is(err, errDuplicateIssue) {
+			summary.skipped(path, data.NextTime, "duplicate")
+		} else if errors.Is(err, errPrecondition) {
+			recordPreconditionSkipped(summary, path, data.NextTime, data)
+		} else if err != nil {
+			return err
+		} else {
+			recordCreated(summary, path, data, issue)
+		}
+
+		err = scheduleIssue(data, data.NextTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	if catchUp && isDue(data.NextTime) {
+		log.Println(path, "has more missed occurrences than MAX_BACKFILL allows - skipping the rest")
+	}
+
+	return nil
+}
+
+// isDue reports whether an occurrence at t should be created now. Occurrences
+// falling within GRACE_PERIOD of the current time count as due, so a run
+// started just before a scheduled time does not leave it to the next run; the
+// occurrence key on the created issue stops the next run creating it again.
+func isDue(t time.Time) bool {
+	return t.Before(time.Now().Add(gracePeriod))
+}
+
+func processOneShot(git *client, path string, data *metadata, summary *runSummary) error {
+	data.NextTime = time.Now()
+	data.PeriodEnd = data.NextTime
+	data.MaxOccurrences = 1
+
+	expired, err := afterEndDate(data, data.NextTime)
+	if err != nil {
+		return err
+	}
+
+	beforeStart, err := beforeStartDate(data)
+	if err != nil {
+		return err
+	}
+
+	if expired || beforeStart {
+		log.Println(path, "is outside its start and end dates - skipping")
+		summary.skipped(path, time.Time{}, "outside start and end dates")
+		return nil
+	}
+
+	log.Println(path, "has no crontab - creating one-shot issue")
+
+	issue, err := createIssue(git, data)
+	if errors.Is(err, errMaxOccurrences) {
+		summary.skipped(path, time.Time{}, "already created")
+		return nil
+	} else if errors.Is(err, errPrecondition) {
+		recordPreconditionSkipped(summary, path, time.Time{}, data)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	recordCreated(summary, path, data, issue)
+	return nil
+}
+
+// recordPreconditionSkipped adds an occurrence skipped by its precondition to
+// the summary. If the precondition could not be checked at all, the due issue
+// was never created, so under STRICT the template also fails.
+func recordPreconditionSkipped(summary *runSummary, path string, nextTime time.Time, data *metadata) {
+	summary.skipped(path, nextTime, "precondition not met")
+
+	warnings := data.Warnings.reset()
+	if strict && len(warnings) > 0 {
+		summary.failed(path, fmt.Errorf("issue skipped with warnings: %s", strings.Join(warnings, "; ")))
+	}
+}
+
+// recordCreated adds a created issue to the summary. Under STRICT, any
+// warnings raised while creating it also fail the template.
+func recordCreated(summary *runSummary, path string, data *metadata, issue *gitlab.Issue) {
+	summary.created(path, data.NextTime, issue)
+
+	warnings := data.Warnings.reset()
+	if strict && len(warnings) > 0 {
+		summary.failed(path, fmt.Errorf("issue created with warnings: %s", strings.Join(warnings, "; ")))
+	}
+}
+
+func templateName(path string) string {
+	name, err := filepath.Rel(issuesRelativePath, path)
+	if err != nil {
+		name = filepath.Base(path)
+	}
+
+	return strings.TrimSuffix(filepath.ToSlash(name), filepath.Ext(name))
+}
+
+func templateLabel(data *metadata) string {
+	return "recurring::" + data.Template
+}
+
+func loadDescriptionFile(data *metadata, templatePath string) error {
+	if data.DescriptionFile == "" {
+		return nil
+	}
+
+	path, err := resolveTemplatePath(filepath.Dir(templatePath), data.DescriptionFile)
+	if err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read descriptionfile %q: %w", data.DescriptionFile, err)
+	}
+
+	data.Description = string(contents)
+
+	return nil
+}
+
+func resolveTemplatePath(dir string, name string) (string, error) {
+	return resolvePathWithin(issuesRelativePath, dir, name, "the templates directory")
+}
+
+func resolvePathWithin(base string, dir string, name string, description string) (string, error) {
+	root, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is outside %s", name, description)
+	}
+
+	return path, nil
+}
+
+func scheduleIssue(data *metadata, lastTime time.Time) error {
+	if len(data.Crontab) == 0 {
+		return errors.New("no crontab specified")
+	}
+
+	location, err := time.LoadLocation(data.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", data.Timezone, err)
+	}
+
+	var schedules []schedule
+
+	for _, crontab := range data.Crontab {
+		schedule, err := parseSchedule(crontab)
+		if err != nil {
+			return err
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	jitter, err := parseJitter(data.Jitter)
+	if err != nil {
+		return err
+	}
+
+	offset := jitterOffset(data.Template, jitter)
+
+	data.NextTime = nextTime(schedules, lastTime.Add(-offset).In(location)).Add(offset)
+	data.PeriodEnd = nextTime(schedules, data.NextTime.Add(-offset)).Add(offset)
+
+	return nil
+}
+
+func beforeStartDate(data *metadata) (bool, error) {
+	if data.StartDate == "" {
+		return false, nil
+	}
+
+	startDate, err := parseTemplateDate(data.StartDate, data.Timezone)
+	if err != nil {
+		return false, fmt.Errorf("invalid startdate: %w", err)
+	}
+
+	return data.NextTime.Before(startDate), nil
+}
+
+func afterEndDate(data *metadata, now time.Time) (bool, error) {
+	if data.EndDate == "" {
+		return false, nil
+	}
+
+	endDate, err := parseTemplateDate(data.EndDate, data.Timezone)
+	if err != nil {
+		return false, fmt.Errorf("invalid enddate: %w", err)
+	}
+
+	return !now.Before(endDate.AddDate(0, 0, 1)), nil
+}
+
+func parseTemplateDate(value string, timezone string) (time.Time, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date in YYYY-MM-DD format: %w", err)
+	}
+
+	return date, nil
+}
+
+func nextTime(schedules []schedule, from time.Time) time.Time {
+	var soonest time.Time
+
+	for _, schedule := range schedules {
+		next := schedule.Next(from)
+		if soonest.IsZero() || next.Before(soonest) {
+			soonest = next
+		}
+	}
+
+	return soonest
+}
+
+func renderTemplate(data *metadata) (*metadata, error) {
+	_, week := data.NextTime.ISOWeek()
+
+	variables := templateVariables{
+		NextTime: data.NextTime,
+		Date:     data.NextTime.Format("2006-01-02"),
+		Year:     data.NextTime.Year(),
+		Month:    data.NextTime.Month(),
+		Week:     week,
+	}
+
+	title, err := renderString("title", data.Title, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	if boolValue(data.AppendDate, false) {
+		format := data.DateFormat
+		if format == "" {
+			format = "2006-01-02"
+		}
+
+		title += " - " + data.NextTime.Format(format)
+	}
+
+	description, err := renderString("description", data.Description, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := *data
+	rendered.Title = title
+	rendered.Description = description
+
+	return &rendered, nil
+}
+
+func renderString(name string, text string, variables templateVariables) (string, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"include": includeFile}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+
+	err = tmpl.Execute(&buffer, variables)
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func includeFile(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("include %q must be a relative path", name)
+	}
+
+	var path string
+	var err error
+	if includeRoot == "repository" {
+		path, err = resolvePathWithin(ciProjectDir, ciProjectDir, name, "the repository")
+	} else {
+		path, err = resolveTemplatePath(issuesRelativePath, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read include %q: %w", name, err)
+	}
+
+	return string(contents), nil
+}
+
+func expandEnvironment(text string) string {
+	return os.Expand(text, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		return os.Getenv(name)
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func boolValue(value *bool, fallback bool) bool {
+	if value == nil {
+		return fallback
+	}
+
+	return *value
+}
+
+func parseMetadata(contents []byte) (*metadata, error) {
+	switch {
+	case bytes.HasPrefix(contents, []byte(tomlDelimiter)):
+		return parseTOMLMetadata(contents)
+	case bytes.HasPrefix(contents, []byte("{")):
+		return parseJSONMetadata(contents)
+	}
+
+	data := new(metadata)
+	err := frontmatter.Unmarshal(contents, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// unknownKeys returns the front matter keys that do not match a metadata
+// field, as the front matter parsers silently ignore them.
+func unknownKeys(contents []byte) ([]string, error) {
+	var fields map[string]interface{}
+
+	switch {
+	case bytes.HasPrefix(contents, []byte(tomlDelimiter)):
+		parts := strings.SplitN(strings.TrimPrefix(string(contents), tomlDelimiter), "\n"+tomlDelimiter, 2)
+		_, err := toml.Decode(parts[0], &fields)
+		if err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(contents, []byte("{")):
+		err := json.NewDecoder(bytes.NewReader(contents)).Decode(&fields)
+		if err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(contents, []byte("---")):
+		parts := strings.SplitN(strings.TrimPrefix(string(contents), "---"), "\n---", 2)
+		if len(parts) != 2 {
+			return nil, nil
+		}
+
+		err := yaml.Unmarshal([]byte(parts[0]), &fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	known := make(map[string]bool)
+
+	fieldType := reflect.TypeOf(metadata{})
+	for i := 0; i < fieldType.NumField(); i++ {
+		name := strings.Split(fieldType.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+
+	var unknown []string
+	for key := range fields {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+
+	sort.Strings(unknown)
+
+	return unknown, nil
+}
+
+func parseTOMLMetadata(contents []byte) (*metadata, error) {
+	parts := strings.SplitN(strings.TrimPrefix(string(contents), tomlDelimiter), "\n"+tomlDelimiter, 2)
+	if len(parts) != 2 {
+		return nil, errors.New("found a heading '+++' without separator '+++'")
+	}
+
+	var fields map[string]interface{}
+	_, err := toml.Decode(parts[0], &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip through YAML so the TOML keys are decoded using the same tags as the YAML front matter
+	yamlFields, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	data := new(metadata)
+	err = yaml.Unmarshal(yamlFields, data)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Description = parts[1]
+
+	return data, nil
+}
+
+func parseJSONMetadata(contents []byte) (*metadata, error) {
+	var fields json.RawMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	err := decoder.Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, so the YAML tags apply to JSON front matter too
+	data := new(metadata)
+	err = yaml.Unmarshal(fields, data)
+	if err != nil {
+		return nil, err
+	}
+
+	description := string(contents[decoder.InputOffset():])
+	description = strings.TrimPrefix(strings.TrimPrefix(description, "\r"), "\n")
+	data.Description = description
+
+	return data, nil
+}
+
+func createIssue(git *client, data *metadata) (*gitlab.Issue, error) {
+	data, err := renderTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if expandEnv {
+		data.Title = expandEnvironment(data.Title)
+		data.Description = expandEnvironment(data.Description)
+	}
+
+	git, err = git.forInstance(data)
+	if err != nil {
+		return nil, err
+	}
+
+	project, resp, err := git.projects.get(templateProjectID(data))
+	if err != nil {
+		if data.Project == "" && data.Group != "" && resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("triage project %q not found in group %q: issues for a group are created in the project named by TRIAGE_PROJECT, or set project in the template instead", triageProject, data.Group)
+		}
+		return nil, err
+	}
+
+	duplicate, err := hasDuplicateIssue(git, project.ID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if duplicate {
+		logDuplicate(data, "an open issue with the same title")
+		return nil, errDuplicateIssue
+	}
+
+	key := occurrenceKey(data)
+
+	if data.Template != "" {
+		exists, err := hasOccurrenceKey(git, project.ID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			logDuplicate(data, "an issue with the same occurrence key")
+			return nil, errDuplicateIssue
+		}
+	}
+
+	if data.MaxOccurrences > 0 {
+		count, err := countTemplateIssues(git, project.ID, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if count >= data.MaxOccurrences {
+			log.Println("Template", data.Template, "has reached its maximum of", data.MaxOccurrences, "occurrences - skipping")
+			return nil, errMaxOccurrences
+		}
+	}
+
+	if data.PreconditionURL != "" {
+		met, err := checkPrecondition(data.PreconditionURL, data.PreconditionStatus)
+		if err != nil {
+			data.Warnings.warn("unable to check precondition for", data.Title, "-", err, "- skipping")
+			return nil, errPrecondition
+		}
+
+		if !met {
+			log.Println("Precondition for", data.Title, "not met - skipping")
+			return nil, errPrecondition
+		}
+	}
+
+	if data.UseTemplate != "" {
+		base, err := projectIssueTemplate(git, project, data.UseTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Description = withIssueTemplate(base, data.Description)
+	}
+
+	if boolValue(data.CarryOver, false) && data.Template != "" {
+		items, err := previousUncheckedItems(git, project.ID, data)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Description = withCarriedOverItems(data.Description, items)
+	}
+
+	// GitLab runs quick actions in the description when the issue is
+	// created, so they are passed through unless the template opts out.
+	if !boolValue(data.QuickActions, true) {
+		data.Description = stripQuickActions(data.Description)
+	}
+
+	if data.Iteration != "" {
+		iterationID, err := resolveIteration(git, project, data.Iteration, data.NextTime)
+		if errors.Is(err, errNoIterations) {
+			data.Warnings.warn(err, "- leaving iteration unset")
+		} else if err != nil {
+			return nil, err
+		} else if iterationID == 0 {
+			log.Println("No open iteration covers", data.NextTime.Format("2006-01-02"), "- leaving iteration unset")
+		} else {
+			data.Description = withIteration(data.Description, iterationID)
+		}
+	}
+
+	// GitLab due dates have no time of day, so the exact time is written
+	// into the description for templates that ask for it.
+	if boolValue(data.DueTime, false) {
+		if data.DueIn == "" || data.DueDate != "" {
+			data.Warnings.warn("duetime requires duein without duedate - ignoring")
+		} else {
+			due, err := parseDueIn(data.DueIn, data.NextTime)
+			if err != nil {
+				return nil, err
+			}
+
+			if rollWeekendDue {
+				due = rollForwardWeekend(due)
+			}
+
+			data.Description = withDueTime(data.Description, due)
+		}
+	}
+
+	data.Description = withMentions(data.Description, data.Mentions)
+
+	if appendFooter {
+		data.Description = withFooter(data)
+	}
+
+	// GitLab rejects descriptions over its size limit, so cut them short
+	// instead, leaving room for the occurrence key.
+	limit := maxDescriptionBytes
+	if data.Template != "" {
+		limit -= len(withOccurrenceKey("\n", key))
+	}
+
+	if description, truncated := truncateDescription(data.Description, limit); truncated {
+		data.Warnings.warn("description of", data.Title, "is", len(data.Description), "bytes, more than MAX_DESCRIPTION_BYTES allows - truncating")
+		data.Description = description
+	}
+
+	if data.Template != "" {
+		data.Description = withOccurrenceKey(data.Description, key)
+	}
+
+	options, err := buildIssueOptions(git, project, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if rollWeekendDue && options.DueDate != nil {
+		dueDate := gitlab.ISOTime(rollForwardWeekend(time.Time(*options.DueDate)))
+		options.DueDate = &dueDate
+	}
+
+	estimate, err := parseEstimate(data.Estimate)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.HealthStatus != "" && !contains(healthStatuses, data.HealthStatus) {
+		return nil, fmt.Errorf("invalid healthstatus %q: must be one of %s", data.HealthStatus, strings.Join(healthStatuses, ", "))
+	}
+
+	var epicIID int
+	if data.Epic != "" {
+		epicIID, err = resolveEpic(git, project, data.Epic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		logDryRun(data, options)
+		return nil, nil
+	}
+
+	if data.Template != "" {
+		err = ensureLabel(git, project.ID, templateLabel(data), "Issues created from the "+data.Template+" recurring issue template")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if createLabels {
+		err = createMissingLabels(git, project.ID, data.Labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var issue *gitlab.Issue
+	attempts := 0
+	err = withRetry(func() (*gitlab.Response, error) {
+		// A create that failed may still have reached GitLab, so look for its
+		// occurrence key before posting the issue again.
+		attempts++
+		if attempts > 1 && data.Template != "" {
+			exists, err := hasOccurrenceKey(git, project.ID, key)
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				logDuplicate(data, "the issue created by an earlier attempt")
+				return nil, errDuplicateIssue
+			}
+		}
+
+		var err error
+		issue, resp, err = createProjectIssue(git, project.ID, options, data.Author)
+		return resp, err
+	})
+	if err != nil {
+		if data.Author != "" && resp != nil && resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("unable to create issue as author %q: the GitLab API token must belong to an administrator and have the sudo scope: %w", data.Author, err)
+		}
+		return nil, err
+	}
+
+	if estimate != "" {
+		err = withRetry(func() (resp *gitlab.Response, err error) {
+			_, resp, err = git.Issues.SetTimeEstimate(project.ID, issue.IID, &gitlab.SetTimeEstimateOptions{Duration: gitlab.String(estimate)})
+			return resp, err
+		})
+		if err != nil {
+			data.Warnings.warn("unable to set time estimate on issue", issue.WebURL, "-", err)
+		}
+	}
+
+	if data.HealthStatus != "" {
+		err = withRetry(func() (*gitlab.Response, error) {
+			return setHealthStatus(git, project.ID, issue.IID, data.HealthStatus)
+		})
+		if err != nil {
+			data.Warnings.warn("unable to set health status on issue", issue.WebURL, "-", err)
+		}
+	}
+
+	if epicIID != 0 {
+		err = withRetry(func() (resp *gitlab.Response, err error) {
+			_, resp, err = git.EpicIssues.AssignEpicIssue(project.Namespace.ID, epicIID, issue.ID)
+			return resp, err
+		})
+		if err != nil {
+			data.Warnings.warn("unable to add issue", issue.WebURL, "to epic", data.Epic, "-", err)
+		}
+	}
+
+	if linkPrevious && data.Template != "" {
+		err = linkPreviousIssue(git, project.ID, data, issue)
+		if err != nil {
+			data.Warnings.warn("unable to link issue", issue.WebURL, "to the previous occurrence -", err)
+		}
+	}
+
+	for _, relation := range []struct {
+		iid      int
+		linkType string
+		field    string
+	}{
+		{data.Blocks, "blocks", "blocks"},
+		{data.BlockedBy, "is_blocked_by", "blockedby"},
+	} {
+		if relation.iid == 0 {
+			continue
+		}
+
+		err = linkBlockingIssue(git, project.ID, issue, relation.iid, relation.linkType)
+		if err != nil {
+			data.Warnings.warn("unable to link issue", issue.WebURL, "to", relation.field, "issue", relation.iid, "-", err)
+		}
+	}
+
+	if len(data.Subscribers) > 0 {
+		subscribeUsers(git, project.ID, issue, data.Subscribers, data.Warnings)
+	}
+
+	if closePrevious && data.Template != "" {
+		err = closePreviousIssue(git, project.ID, data, issue)
+		if err != nil {
+			data.Warnings.warn("unable to close the previous occurrence of", issue.WebURL, "-", err)
+		}
+	}
+
+	if notifyWebhookURL != "" {
+		err = notifyWebhook(notifyWebhookURL, data, issue)
+		if err != nil {
+			data.Warnings.warn("unable to send notification for issue", issue.WebURL, "-", err)
+		}
+	}
+
+	return issue, nil
+}
+
+func lastCreatedTime(git *client, data *metadata) (time.Time, error) {
+	git, err := git.forInstance(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		Labels:      gitlab.Labels{templateLabel(data)},
+		OrderBy:     gitlab.String("created_at"),
+		Sort:        gitlab.String("desc"),
+	}
+
+	var issues []*gitlab.Issue
+	err = withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(templateProjectID(data), options)
+		return resp, err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(issues) == 0 || issues[0].CreatedAt == nil {
+		return time.Time{}, nil
+	}
+
+	return *issues[0].CreatedAt, nil
+}
+
+func projectIssueTemplate(git *client, project *gitlab.Project, name string) (string, error) {
+	file := ".gitlab/issue_templates/" + name + ".md"
+
+	var contents []byte
+	var resp *gitlab.Response
+	err := withRetry(func() (*gitlab.Response, error) {
+		var err error
+		contents, resp, err = git.RepositoryFiles.GetRawFile(project.ID, file, &gitlab.GetRawFileOptions{Ref: gitlab.String(project.DefaultBranch)})
+		return resp, err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("issue template %q not found: expected %s on the default branch", name, file)
+		}
+		return "", err
+	}
+
+	return string(contents), nil
+}
+
+func withIssueTemplate(base string, description string) string {
+	if strings.TrimSpace(description) == "" {
+		return base
+	}
+
+	return strings.TrimRight(base, "\n") + "\n\n" + description
+}
+
+var quickActionPattern = regexp.MustCompile(`^/[a-z_]+(\s|$)`)
+
+func stripQuickActions(description string) string {
+	var lines []string
+	inCodeBlock := false
+
+	for _, line := range strings.Split(description, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCodeBlock = !inCodeBlock
+		}
+
+		if !inCodeBlock && quickActionPattern.MatchString(line) {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func previousUncheckedItems(git *client, projectID int, data *metadata) ([]string, error) {
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		State:       gitlab.String("closed"),
+		Labels:      gitlab.Labels{templateLabel(data)},
+		OrderBy:     gitlab.String("created_at"),
+		Sort:        gitlab.String("desc"),
+	}
+
+	var issues []*gitlab.Issue
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(issues) == 0 {
+		return nil, nil
+	}
+
+	return uncheckedItems(issues[0].Description), nil
+}
+
+func uncheckedItems(description string) []string {
+	var items []string
+	inCodeBlock := false
+
+	for _, line := range strings.Split(description, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+
+		if inCodeBlock {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- [ ] ") || strings.HasPrefix(trimmed, "* [ ] ") {
+			items = append(items, "- [ ] "+strings.TrimSpace(trimmed[6:]))
+		}
+	}
+
+	return items
+}
+
+func withCarriedOverItems(description string, items []string) string {
+	if len(items) == 0 {
+		return description
+	}
+
+	section := "## Carried over\n\n" + strings.Join(items, "\n")
+	if description == "" {
+		return section
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + section
+}
+
+func withMentions(description string, mentions []string) string {
+	if len(mentions) == 0 {
+		return description
+	}
+
+	references := make([]string, len(mentions))
+	for i, mention := range mentions {
+		references[i] = "@" + strings.TrimPrefix(strings.TrimSpace(mention), "@")
+	}
+
+	line := "cc " + strings.Join(references, " ")
+	if description == "" {
+		return line
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + line
+}
+
+func withDueTime(description string, due time.Time) string {
+	line := "Due by " + due.Format("2006-01-02 15:04 MST")
+	if description == "" {
+		return line
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + line
+}
+
+func withFooter(data *metadata) string {
+	footer := fmt.Sprintf("Created by gitlab-recurring-issues from `%s` on `%s`", data.Template, data.NextTime.Format("2006-01-02"))
+	if data.Description == "" {
+		return footer
+	}
+
+	return strings.TrimRight(data.Description, "\n") + "\n\n---\n\n" + footer
+}
+
+func templateProjectID(data *metadata) string {
+	if data.Project != "" {
+		return data.Project
+	}
+
+	if data.Group != "" {
+		return data.Group + "/" + triageProject
+	}
+
+	return ciProjectID
+}
+
+func parseEstimate(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid estimate %q: %w", value, err)
+	}
+
+	return fmt.Sprintf("%ds", int64(duration.Seconds())), nil
+}
+
+// logDuplicate reports an occurrence skipped because an issue already exists
+// for it. Dry runs still look for duplicates, so they show what would be
+// skipped alongside what would be created.
+func logDuplicate(data *metadata, existing string) {
+	if dryRun {
+		log.Println("Dry run - WOULD SKIP (duplicate):", data.Template, "-", data.Title, "at", data.NextTime.Format(time.RFC3339), "matches", existing)
+		return
+	}
+
+	log.Println("Issue", data.Title, "already exists for", data.NextTime.Format(time.RFC3339), "as", existing, "- skipping")
+}
+
+func logDryRun(data *metadata, options *createIssueOptions) {
+	log.Println("Dry run - WOULD CREATE:", data.Template, "-", data.Title, "at", data.NextTime.Format(time.RFC3339))
+	log.Println("  Title:", *options.Title)
+	log.Println("  Description:", *options.Description)
+	log.Println("  Type:", *options.IssueType)
+
+	if data.HealthStatus != "" {
+		log.Println("  Health status:", data.HealthStatus)
+	}
+
+	if options.Labels != nil {
+		log.Println("  Labels:", strings.Join(*options.Labels, ", "))
+	}
+
+	if data.Author != "" {
+		log.Println("  Author:", data.Author)
+	}
+
+	if len(data.Assignees) > 0 {
+		log.Println("  Assignees:", strings.Join(data.Assignees, ", "), options.AssigneeIDs)
+	}
+
+	if options.DueDate != nil {
+		log.Println("  Due date:", time.Time(*options.DueDate).Format("2006-01-02"))
+	}
+}
+
+func createProjectIssue(git *client, projectID int, options *createIssueOptions, author string) (*gitlab.Issue, *gitlab.Response, error) {
+	var requestOptions []gitlab.RequestOptionFunc
+	if author != "" {
+		requestOptions = append(requestOptions, gitlab.WithSudo(author))
+	}
+
+	req, err := git.NewRequest(http.MethodPost, fmt.Sprintf("projects/%d/issues", projectID), options, requestOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issue := new(gitlab.Issue)
+	resp, err := git.Do(req, issue)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return issue, resp, nil
+}
+
+func setHealthStatus(git *client, projectID int, issueIID int, healthStatus string) (*gitlab.Response, error) {
+	options := struct {
+		HealthStatus string `json:"health_status"`
+	}{healthStatus}
+
+	req, err := git.NewRequest(http.MethodPut, fmt.Sprintf("projects/%d/issues/%d", projectID, issueIID), options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return git.Do(req, nil)
+}
+
+func linkPreviousIssue(git *client, projectID int, data *metadata, issue *gitlab.Issue) error {
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 2},
+		Labels:      gitlab.Labels{templateLabel(data)},
+		OrderBy:     gitlab.String("created_at"),
+		Sort:        gitlab.String("desc"),
+	}
+
+	var issues []*gitlab.Issue
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, previous := range issues {
+		if previous.IID == issue.IID {
+			continue
+		}
+
+		return withRetry(func() (resp *gitlab.Response, err error) {
+			_, resp, err = git.IssueLinks.CreateIssueLink(projectID, issue.IID, &gitlab.CreateIssueLinkOptions{
+				TargetProjectID: gitlab.String(strconv.Itoa(projectID)),
+				TargetIssueIID:  gitlab.String(strconv.Itoa(previous.IID)),
+			})
+			return resp, err
+		})
+	}
+
+	return nil
+}
+
+func linkBlockingIssue(git *client, projectID int, issue *gitlab.Issue, targetIID int, linkType string) error {
+	var resp *gitlab.Response
+	err := withRetry(func() (*gitlab.Response, error) {
+		var err error
+		_, resp, err = git.Issues.GetIssue(projectID, targetIID)
+		return resp, err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("issue #%d not found in project %d", targetIID, projectID)
+		}
+		return err
+	}
+
+	options := struct {
+		TargetProjectID string `json:"target_project_id"`
+		TargetIssueIID  string `json:"target_issue_iid"`
+		LinkType        string `json:"link_type"`
+	}{strconv.Itoa(projectID), strconv.Itoa(targetIID), linkType}
+
+	req, err := git.NewRequest(http.MethodPost, fmt.Sprintf("projects/%d/issues/%d/links", projectID, issue.IID), options, nil)
+	if err != nil {
+		return err
+	}
+
+	return withRetry(func() (*gitlab.Response, error) {
+		return git.Do(req, nil)
+	})
+}
+
+func closePreviousIssue(git *client, projectID int, data *metadata, issue *gitlab.Issue) error {
+	label := templateLabel(data)
+
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 2},
+		State:       gitlab.String("opened"),
+		Labels:      gitlab.Labels{label},
+		OrderBy:     gitlab.String("created_at"),
+		Sort:        gitlab.String("desc"),
+	}
+
+	var issues []*gitlab.Issue
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, previous := range issues {
+		// Only close an open issue carrying this template's label that was
+		// created before the new one, so unrelated issues are never touched.
+		if previous.IID == issue.IID || previous.State != "opened" || !contains(previous.Labels, label) {
+			continue
+		}
+
+		if previous.CreatedAt != nil && issue.CreatedAt != nil && previous.CreatedAt.After(*issue.CreatedAt) {
+			continue
+		}
+
+		err = withRetry(func() (resp *gitlab.Response, err error) {
+			_, resp, err = git.Issues.UpdateIssue(projectID, previous.IID, &gitlab.UpdateIssueOptions{
+				StateEvent: gitlab.String("close"),
+			})
+			return resp, err
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Println("Closed previous occurrence", previous.WebURL)
+		return nil
+	}
+
+	return nil
+}
+
+func ensureLabel(git *client, projectID int, name string, description string) error {
+	options := &gitlab.CreateLabelOptions{
+		Name:        gitlab.String(name),
+		Color:       gitlab.String(labelColor),
+		Description: gitlab.String(description),
+	}
+
+	return withRetry(func() (*gitlab.Response, error) {
+		_, resp, err := git.Labels.CreateLabel(projectID, options)
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			return resp, nil
+		}
+
+		return resp, err
+	})
+}
+
+func createMissingLabels(git *client, projectID int, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	existing := make(map[string]bool)
+
+	options := &gitlab.ListLabelsOptions{Page: 1, PerPage: 100}
+	for {
+		var projectLabels []*gitlab.Label
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			projectLabels, resp, err = git.Labels.ListLabels(projectID, options)
+			return resp, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, label := range projectLabels {
+			existing[label.Name] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	for _, label := range labels {
+		if existing[label] {
+			continue
+		}
+
+		log.Println("Creating missing label", label)
+
+		err := ensureLabel(git, projectID, label, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func countTemplateIssues(git *client, projectID int, data *metadata) (int, error) {
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		Labels:      gitlab.Labels{templateLabel(data)},
+	}
+
+	var resp *gitlab.Response
+	err := withRetry(func() (*gitlab.Response, error) {
+		var err error
+		_, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.TotalItems, nil
+}
+
+func occurrenceKey(data *metadata) string {
+	sum := sha256.Sum256([]byte(data.Template + "@" + data.NextTime.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func occurrenceMarker(key string) string {
+	return "<!-- recurring-issues-key: " + key + " -->"
+}
+
+const truncatedMarker = "…(truncated)"
+
+// truncateDescription shortens a description to at most limit bytes,
+// including the truncated marker, without splitting a UTF-8 character.
+func truncateDescription(description string, limit int) (string, bool) {
+	if len(description) <= limit {
+		return description, false
+	}
+
+	end := limit - len(truncatedMarker)
+	if end < 0 {
+		end = 0
+	}
+
+	for end > 0 && !utf8.RuneStart(description[end]) {
+		end--
+	}
+
+	return description[:end] + truncatedMarker, true
+}
+
+func withOccurrenceKey(description string, key string) string {
+	if description == "" {
+		return occurrenceMarker(key)
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + occurrenceMarker(key)
+}
+
+func hasOccurrenceKey(git *client, projectID int, key string) (bool, error) {
+	options := &gitlab.ListProjectIssuesOptions{
+		Search: gitlab.String(key),
+		In:     gitlab.String("description"),
+	}
+
+	var issues []*gitlab.Issue
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, issue := range issues {
+		if strings.Contains(issue.Description, occurrenceMarker(key)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func hasDuplicateIssue(git *client, projectID int, data *metadata) (bool, error) {
+	options := &gitlab.ListProjectIssuesOptions{
+		State:         gitlab.String("opened"),
+		Search:        gitlab.String(data.Title),
+		In:            gitlab.String("title"),
+		CreatedAfter:  &data.NextTime,
+		CreatedBefore: &data.PeriodEnd,
+	}
+
+	var issues []*gitlab.Issue
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		issues, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		return resp, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, issue := range issues {
+		if issue.Title == data.Title {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func buildIssueOptions(git *client, project *gitlab.Project, data *metadata) (*createIssueOptions, error) {
+	confidential := boolValue(data.Confidential, defaultConfidential)
+
+	issueType := data.IssueType
+	if issueType == "" {
+		issueType = "issue"
+	}
+
+	if !contains(issueTypes, issueType) {
+		return nil, fmt.Errorf("invalid issuetype %q: must be one of %s", issueType, strings.Join(issueTypes, ", "))
+	}
+
+	assignees := data.Assignees
+	if len(assignees) == 0 && defaultAssignee != "" {
+		assignees = []string{defaultAssignee}
+	}
+
+	if data.AssigneeStrategy != "" {
+		if !contains(assigneeStrategies, data.AssigneeStrategy) {
+			return nil, fmt.Errorf("invalid assignee_strategy %q: must be one of %s", data.AssigneeStrategy, strings.Join(assigneeStrategies, ", "))
+		}
+
+		assignee, err := nextPoolAssignee(git, project.ID, data)
+		if err != nil {
+			data.Warnings.warn("unable to pick the next assignee from assignee_pool -", err)
+		} else {
+			assignees = []string{assignee}
+		}
+	}
+
+	assignees = resolveOnCall(assignees, data)
+
+	assigneeIDs := resolveAssignees(git, assignees, data.Warnings)
+
+	if validateAssignees && len(assigneeIDs) > 0 {
+		err := warnNonMemberAssignees(git, project.ID, assigneeIDs, data.Warnings)
+		if err != nil {
+			data.Warnings.warn("unable to check project members -", err)
+		}
+	}
+
+	options := &createIssueOptions{
+		CreateIssueOptions: &gitlab.CreateIssueOptions{
+			Title:        gitlab.String(data.Title),
+			Description:  gitlab.String(data.Description),
+			Confidential: &confidential,
+			AssigneeIDs:  assigneeIDs,
+			Weight:       data.Weight,
+		},
+		IssueType: gitlab.String(issueType),
+	}
+
+	if createdAtMode == "occurrence" {
+		options.CreatedAt = &data.NextTime
+	}
+
+	labels := append(gitlab.Labels{}, data.Labels...)
+	if data.Template != "" {
+		labels = append(labels, templateLabel(data))
+	}
+
+	if len(labels) > 0 {
+		options.Labels = &labels
+	}
+
+	if data.Milestone == "auto" {
+		milestoneID, err := findMilestoneForDate(git, project, data.NextTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if milestoneID != 0 {
+			options.MilestoneID = &milestoneID
+		} else {
+			log.Println("No open milestone covers", data.NextTime.Format("2006-01-02"), "- leaving milestone unset")
+		}
+	} else if data.Milestone != "" {
+		milestoneID, err := resolveMilestone(git, project, data.Milestone)
+		if err != nil {
+			return nil, err
+		}
+
+		options.MilestoneID = &milestoneID
+	}
+
+	if data.DueDate != "" {
+		if data.DueIn != "" {
+			log.Println("Both duedate and duein are set - ignoring duein")
+		}
+
+		dueDate, err := parseDueDate(data.DueDate, data.NextTime)
+		if err != nil {
+			return nil, err
+		}
+
+		options.DueDate = &dueDate
+	} else if data.DueIn != "" {
+		due, err := parseDueIn(data.DueIn, data.NextTime)
+		if err != nil {
+			return nil, err
+		}
+
+		dueDate := gitlab.ISOTime(due)
+
+		options.DueDate = &dueDate
+	}
+
+	return options, nil
+}
+
+func parseDueDate(value string, from time.Time) (gitlab.ISOTime, error) {
+	if !strings.HasPrefix(value, "+") {
+		dueDate, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return gitlab.ISOTime{}, fmt.Errorf("invalid duedate %q: expected YYYY-MM-DD or an offset such as +3d or +2w", value)
+		}
+
+		return gitlab.ISOTime(dueDate), nil
+	}
+
+	if len(value) < 3 {
+		return gitlab.ISOTime{}, fmt.Errorf("invalid duedate %q: expected YYYY-MM-DD or an offset such as +3d or +2w", value)
+	}
+
+	count, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || count < 0 {
+		return gitlab.ISOTime{}, fmt.Errorf("invalid duedate %q: expected YYYY-MM-DD or an offset such as +3d or +2w", value)
+	}
+
+	switch value[len(value)-1] {
+	case 'd':
+		return gitlab.ISOTime(from.AddDate(0, 0, count)), nil
+	case 'w':
+		return gitlab.ISOTime(from.AddDate(0, 0, count*7)), nil
+	}
+
+	return gitlab.ISOTime{}, fmt.Errorf("invalid duedate %q: expected YYYY-MM-DD or an offset such as +3d or +2w", value)
+}
+
+func parseDueIn(value string, from time.Time) (time.Time, error) {
+	if strings.HasPrefix(value, "eom") {
+		return parseEndOfMonth(value, from)
+	}
+
+	if strings.HasSuffix(value, "bd") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "bd"))
+		if err != nil || days < 0 {
+			return time.Time{}, fmt.Errorf("invalid duein %q: expected a duration such as 24h or a number of business days such as 3bd", value)
+		}
+
+		return addBusinessDays(from, days), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return from.Add(duration), nil
+}
+
+// parseEndOfMonth handles "eom", the last day of the month of from, and
+// offsets before it such as "eom-3d".
+func parseEndOfMonth(value string, from time.Time) (time.Time, error) {
+	days := 0
+
+	if offset := strings.TrimPrefix(value, "eom"); offset != "" {
+		var err error
+		if strings.HasPrefix(offset, "-") && strings.HasSuffix(offset, "d") {
+			days, err = strconv.Atoi(offset[1 : len(offset)-1])
+		}
+		if err != nil || days <= 0 {
+			return time.Time{}, fmt.Errorf("invalid duein %q: expected eom or an offset before it such as eom-3d", value)
+		}
+	}
+
+	// Day zero of the next month normalises to the last day of this month
+	endOfMonth := time.Date(from.Year(), from.Month()+1, 0, from.Hour(), from.Minute(), from.Second(), 0, from.Location())
+
+	return endOfMonth.AddDate(0, 0, -days), nil
+}
+
+func addBusinessDays(from time.Time, days int) time.Time {
+	due := from
+	for days > 0 {
+		due = due.AddDate(0, 0, 1)
+		if !isBusinessDay(due) {
+			continue
+		}
+
+		days--
+	}
+
+	return due
+}
+
+func rollForwardWeekend(date time.Time) time.Time {
+	switch date.Weekday() {
+	case time.Saturday:
+		return date.AddDate(0, 0, 2)
+	case time.Sunday:
+		return date.AddDate(0, 0, 1)
+	}
+
+	return date
+}
+
+func loadHolidays(path string) (map[string]bool, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]bool)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		_, err := time.Parse("2006-01-02", line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: expected YYYY-MM-DD", line)
+		}
+
+		dates[line] = true
+	}
+
+	return dates, nil
+}
+
+// nextPoolAssignee picks the member of the template's assignee pool whose turn
+// it is, counting every issue created so far from the template, open or
+// closed, so the rotation carries on across runs without any stored state.
+func nextPoolAssignee(git *client, projectID int, data *metadata) (string, error) {
+	if len(data.AssigneePool) == 0 {
+		return "", errors.New("assignee_pool is empty")
+	}
+
+	options := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		Labels:      gitlab.Labels{templateLabel(data)},
+		Scope:       gitlab.String("all"),
+	}
+
+	var count int
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		_, resp, err = git.Issues.ListProjectIssues(projectID, options)
+		if err == nil {
+			count = resp.TotalItems
+		}
+		return resp, err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return data.AssigneePool[count%len(data.AssigneePool)], nil
+}
+
+func resolveOnCall(assignees []string, data *metadata) []string {
+	var resolved []string
+
+	for _, assignee := range assignees {
+		if assignee != onCallAssignee {
+			resolved = append(resolved, assignee)
+			continue
+		}
+
+		if onCallRotation == nil {
+			data.Warnings.warn("assignee", onCallAssignee, "requires ONCALL_ROTATION_FILE - skipping")
+			continue
+		}
+
+		username, err := onCallRotation.onCall(data.NextTime)
+		if err != nil {
+			data.Warnings.warn("unable to find who is on call -", err)
+			continue
+		}
+
+		resolved = append(resolved, username)
+	}
+
+	return resolved
+}
+
+func resolveAssignees(git *client, usernames []string, warnings *warningLog) []int {
+	var assigneeIDs []int
+
+	for _, username := range usernames {
+		if id, err := strconv.Atoi(username); err == nil {
+			assigneeIDs = append(assigneeIDs, id)
+			continue
+		}
+
+		id, err := git.users.resolve(username)
+		if errors.Is(err, errUserNotFound) {
+			warnings.warn("assignee", username, "not found - skipping")
+			continue
+		}
+		if err != nil {
+			warnings.warn("unable to look up assignee", username, "-", err)
+			continue
+		}
+
+		assigneeIDs = append(assigneeIDs, id)
+	}
+
+	return assigneeIDs
+}
+
+// subscribeUsers subscribes each user to the issue's notifications. GitLab
+// only subscribes the current user, so each request is made as the user with
+// sudo, which needs a token belonging to an administrator.
+func subscribeUsers(git *client, projectID int, issue *gitlab.Issue, usernames []string, warnings *warningLog) {
+	for _, username := range usernames {
+		id, err := strconv.Atoi(username)
+		if err != nil {
+			id, err = git.users.resolve(username)
+		}
+		if errors.Is(err, errUserNotFound) {
+			warnings.warn("subscriber", username, "not found - skipping")
+			continue
+		}
+		if err != nil {
+			warnings.warn("unable to look up subscriber", username, "-", err)
+			continue
+		}
+
+		err = withRetry(func() (resp *gitlab.Response, err error) {
+			_, resp, err = git.Issues.SubscribeToIssue(projectID, issue.IID, gitlab.WithSudo(id))
+			if resp != nil && resp.StatusCode == http.StatusNotModified {
+				return resp, nil
+			}
+			return resp, err
+		})
+		if err != nil {
+			warnings.warn("unable to subscribe", username, "to issue", issue.WebURL, "-", err)
+		}
+	}
+}
+
+func warnNonMemberAssignees(git *client, projectID int, assigneeIDs []int, warnings *warningLog) error {
+	members := make(map[int]bool)
+
+	// Include inherited members, as members of parent groups can be assigned too
+	options := &gitlab.ListProjectMembersOptions{ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100}}
+	for {
+		var projectMembers []*gitlab.ProjectMember
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			projectMembers, resp, err = git.ProjectMembers.ListAllProjectMembers(projectID, options)
+			return resp, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, member := range projectMembers {
+			members[member.ID] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	for _, id := range assigneeIDs {
+		if !members[id] {
+			warnings.warn("assignee", id, "is not a member of project", projectID, "- GitLab may not assign the issue to them")
+		}
+	}
+
+	return nil
+}
+
+func resolveMilestone(git *client, project *gitlab.Project, title string) (int, error) {
+	id, err := findMilestone(git, project,
+		&gitlab.ListMilestonesOptions{Title: gitlab.String(title)},
+		&gitlab.ListGroupMilestonesOptions{Search: title},
+		func(milestoneTitle string, startDate *gitlab.ISOTime, dueDate *gitlab.ISOTime) bool {
+			return milestoneTitle == title
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	if id == 0 {
+		return 0, fmt.Errorf("milestone %q not found in project or group", title)
+	}
+
+	return id, nil
+}
+
+func findMilestoneForDate(git *client, project *gitlab.Project, date time.Time) (int, error) {
+	return findMilestone(git, project,
+		&gitlab.ListMilestonesOptions{State: gitlab.String("active")},
+		&gitlab.ListGroupMilestonesOptions{State: "active"},
+		func(title string, startDate *gitlab.ISOTime, dueDate *gitlab.ISOTime) bool {
+			return milestoneContains(startDate, dueDate, date)
+		})
+}
+
+// findMilestone returns the ID of the first project milestone, or failing
+// that group milestone, that matches, reading every page of each. It returns
+// zero if none match.
+func findMilestone(git *client, project *gitlab.Project, options *gitlab.ListMilestonesOptions, groupOptions *gitlab.ListGroupMilestonesOptions, match func(title string, startDate *gitlab.ISOTime, dueDate *gitlab.ISOTime) bool) (int, error) {
+	options.Page, options.PerPage = 1, 100
+	for {
+		var milestones []*gitlab.Milestone
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			milestones, resp, err = git.Milestones.ListMilestones(project.ID, options)
+			return resp, err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, milestone := range milestones {
+			if match(milestone.Title, milestone.StartDate, milestone.DueDate) {
+				return milestone.ID, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	if project.Namespace == nil || project.Namespace.Kind != "group" {
+		return 0, nil
+	}
+
+	groupOptions.Page, groupOptions.PerPage = 1, 100
+	for {
+		var milestones []*gitlab.GroupMilestone
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			milestones, resp, err = git.GroupMilestones.ListGroupMilestones(project.Namespace.ID, groupOptions)
+			return resp, err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, milestone := range milestones {
+			if match(milestone.Title, milestone.StartDate, milestone.DueDate) {
+				return milestone.ID, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		groupOptions.Page = resp.NextPage
+	}
+
+	return 0, nil
+}
+
+func milestoneContains(startDate *gitlab.ISOTime, dueDate *gitlab.ISOTime, date time.Time) bool {
+	if startDate == nil || dueDate == nil {
+		return false
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	return !day.Before(time.Time(*startDate)) && !day.After(time.Time(*dueDate))
+}
+
+type iteration struct {
+	ID        int             `json:"id"`
+	Title     string          `json:"title"`
+	StartDate *gitlab.ISOTime `json:"start_date"`
+	DueDate   *gitlab.ISOTime `json:"due_date"`
+}
+
+// resolveIteration finds the ID of an iteration in the project's group or its
+// ancestors, by ID, by title, or for "auto" by the iteration covering date.
+// It returns zero if "auto" finds no iteration.
+func resolveIteration(git *client, project *gitlab.Project, value string, date time.Time) (int, error) {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+
+	if project.Namespace == nil || project.Namespace.Kind != "group" {
+		return 0, fmt.Errorf("iteration %q cannot be used as the project does not belong to a group", value)
+	}
+
+	options := struct {
+		State            string `url:"state"`
+		IncludeAncestors bool   `url:"include_ancestors"`
+		PerPage          int    `url:"per_page"`
+	}{"opened", true, 100}
+
+	req, err := git.NewRequest(http.MethodGet, fmt.Sprintf("groups/%d/iterations", project.Namespace.ID), &options, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var iterations []*iteration
+	var resp *gitlab.Response
+	err = withRetry(func() (*gitlab.Response, error) {
+		var err error
+		resp, err = git.Do(req, &iterations)
+		return resp, err
+	})
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+			return 0, fmt.Errorf("group %s has no %w (iterations require GitLab Premium)", project.Namespace.FullPath, errNoIterations)
+		}
+
+		return 0, err
+	}
+
+	for _, i := range iterations {
+		if value == "auto" && milestoneContains(i.StartDate, i.DueDate, date) {
+			return i.ID, nil
+		}
+
+		if i.Title == value {
+			return i.ID, nil
+		}
+	}
+
+	if value == "auto" {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("iteration %q not found in group %s", value, project.Namespace.FullPath)
+}
+
+// withIteration sets the iteration with a quick action, which GitLab runs
+// when the issue is created.
+func withIteration(description string, iterationID int) string {
+	action := fmt.Sprintf("/iteration *iteration:%d", iterationID)
+	if description == "" {
+		return action
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + action
+}
+
+func resolveEpic(git *client, project *gitlab.Project, epic string) (int, error) {
+	if project.Namespace == nil || project.Namespace.Kind != "group" {
+		return 0, fmt.Errorf("epic %q cannot be used as the project does not belong to a group", epic)
+	}
+
+	if iid, err := strconv.Atoi(epic); err == nil {
+		return iid, nil
+	}
+
+	options := &gitlab.ListGroupEpicsOptions{Search: gitlab.String(epic)}
+	options.Page, options.PerPage = 1, 100
+	for {
+		var epics []*gitlab.Epic
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			epics, resp, err = git.Epics.ListGroupEpics(project.Namespace.ID, options)
+			return resp, err
+		})
+		if err != nil {
+			if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound) {
+				return 0, fmt.Errorf("group %s has no epics available (epics require GitLab Premium): %w", project.Namespace.FullPath, err)
+			}
+
+			return 0, err
+		}
+
+		for _, e := range epics {
+			if e.Title == epic {
+				return e.IID, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	return 0, fmt.Errorf("epic %q not found in group %s", epic, project.Namespace.FullPath)
+}
+
+func newGitLabClient() (*client, error) {
+	git, err := gitlab.NewClient(gitlabAPIToken, gitlab.WithBaseURL(ciAPIV4URL), gitlab.WithHTTPClient(newHTTPClient()), gitlab.WithoutRetries())
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(git), nil
+}
+
+func withRetry(request func() (*gitlab.Response, error)) error {
+	for attempt := 1; ; attempt++ {
+		resp, err := request()
+		if err == nil || errors.Is(err, errDuplicateIssue) || attempt >= maxRetries || !isRetryable(resp) {
+			return err
+		}
+
+		delay := retryDelay * time.Duration(1<<(attempt-1))
+		if wait, ok := retryAfter(resp); ok {
+			delay = wait
+		}
+
+		log.Println("Warning: GitLab API request failed -", err, "- retrying in", delay)
+		time.Sleep(delay)
+	}
+}
+
+func isRetryable(resp *gitlab.Response) bool {
+	if resp == nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+func retryAfter(resp *gitlab.Response) (time.Duration, bool) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
+
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := t.limiter.Wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func newHTTPClient() *http.Client {
+	var transport http.RoundTripper = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: gitlabInsecureTLS},
+	}
+
+	if rateLimit > 0 {
+		transport = &rateLimitedTransport{limiter: rate.NewLimiter(rate.Limit(rateLimit), 1), next: transport}
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// checkToken fails fast when GITLAB_API_TOKEN cannot authenticate or lacks
+// the api scope, rather than after templates have been processed. Tokens
+// whose scopes cannot be read, such as on older GitLab versions, are accepted.
+func checkToken(git *client, variable string) error {
+	var resp *gitlab.Response
+	err := withRetry(func() (*gitlab.Response, error) {
+		var err error
+		_, resp, err = git.Users.CurrentUser()
+		return resp, err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%s was rejected by GitLab. Check that the token is valid and has not expired: %w", variable, err)
+		}
+		return err
+	}
+
+	req, err := git.NewRequest(http.MethodGet, "personal_access_tokens/self", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var token struct {
+		Scopes []string `json:"scopes"`
+	}
+	err = withRetry(func() (*gitlab.Response, error) {
+		var err error
+		resp, err = git.Do(req, &token)
+		return resp, err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode < http.StatusInternalServerError {
+			return nil
+		}
+		return err
+	}
+
+	// A dry run only reads from GitLab, so a read-only token is enough
+	if dryRun {
+		if !contains(token.Scopes, "api") && !contains(token.Scopes, "read_api") {
+			return fmt.Errorf("%s must have the 'api' or 'read_api' scope for a dry run, but only has: %s", variable, strings.Join(token.Scopes, ", "))
+		}
+		return nil
+	}
+
+	if !contains(token.Scopes, "api") {
+		return fmt.Errorf("%s must have the 'api' scope to create issues, but only has: %s", variable, strings.Join(token.Scopes, ", "))
+	}
+
+	return nil
+}
+
+func getLastRunTime(git *client) (time.Time, error) {
+	options := &gitlab.ListProjectPipelinesOptions{
+		ListOptions: gitlab.ListOptions{Page: 1},
+		Scope:       gitlab.String("finished"),
+		Status:      gitlab.BuildState(gitlab.Success),
+		OrderBy:     gitlab.String("updated_at"),
+	}
+
+	// Only count runs on one branch, so pipelines for merge requests or
+	// other branches do not move the last run forward.
+	if pipelineRef != "" {
+		options.Ref = gitlab.String(pipelineRef)
+	}
+
+	for {
+		var pipelineInfos []*gitlab.PipelineInfo
+		var pipelinesResp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			pipelineInfos, pipelinesResp, err = git.Pipelines.ListProjectPipelines(ciProjectID, options)
+			return pipelinesResp, err
+		})
+		if err != nil {
+			return time.Unix(0, 0), err
+		}
+
+		for _, pipelineInfo := range pipelineInfos {
+			var jobs []*gitlab.Job
+			err := withRetry(func() (resp *gitlab.Response, err error) {
+				jobs, resp, err = git.Jobs.ListPipelineJobs(ciProjectID, pipelineInfo.ID, nil)
+				return resp, err
+			})
+			if err != nil {
+				return time.Unix(0, 0), err
+			}
+
+			for _, job := range jobs {
+				if job.Name == ciJobName && job.FinishedAt != nil {
+					return *job.FinishedAt, nil
+				}
+			}
+		}
+
+		if pipelinesResp.NextPage == 0 {
+			break
+		}
+
+		options.Page = pipelinesResp.NextPage
+	}
+
+	return time.Unix(0, 0), nil
+}
+
+func getBoolEnv(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Environment variable '%s' must be a boolean value (e.g. 'true' or 'false').", key)
+	}
+
+	return result, nil
+}
+
+func getIntEnv(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Environment variable '%s' must be an integer value.", key)
+	}
+
+	return result, nil
+}
+
+// validProjectID reports whether value is a numeric project ID or a path with
+// namespace, both of which the GitLab API accepts wherever a project is named.
+func validProjectID(value string) bool {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id > 0
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, " \t") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadScheduleEnvironment reads the variables that change when templates are
+// due. It runs before any command, so that --preview, --list-templates, and
+// --validate see the same schedules as a real run.
+func loadScheduleEnvironment() error {
+	var err error
+
+	fiscalYearStart, err = getIntEnv("FISCAL_YEAR_START", 1)
+	if err != nil {
+		return err
+	}
+	if fiscalYearStart < 1 || fiscalYearStart > 12 {
+		return errors.New("Environment variable 'FISCAL_YEAR_START' must be a month number from 1 to 12.")
+	}
+
+	if value := os.Getenv("BIWEEKLY_ANCHOR"); value != "" {
+		biweeklyAnchor, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return errors.New("Environment variable 'BIWEEKLY_ANCHOR' must be a date in the form YYYY-MM-DD.")
+		}
+	}
+
+	if file := os.Getenv("HOLIDAYS_FILE"); file != "" {
+		holidays, err = loadHolidays(file)
+		if err != nil {
+			return fmt.Errorf("Environment variable 'HOLIDAYS_FILE' must name a file of YYYY-MM-DD dates: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func loadEnvironment() error {
+	if token := os.Getenv("GITLAB_API_TOKEN"); token != "" {
+		gitlabAPIToken = token
+	}
+	if gitlabAPIToken == "" {
+		return errors.New("Environment variable 'GITLAB_API_TOKEN' not found. Ensure this is set under the project CI/CD settings or in the --config file.")
+	}
+
+	var err error
+
+	gitlabInsecureTLS, err = getBoolEnv("GITLAB_INSECURE_TLS")
+	if err != nil {
+		return err
+	}
+
+	dryRun, err = getBoolEnv("DRY_RUN")
+	if err != nil {
+		return err
+	}
+
+	defaultConfidential, err = getBoolEnv("DEFAULT_CONFIDENTIAL")
+	if err != nil {
+		return err
+	}
+
+	catchUp, err = getBoolEnv("CATCH_UP")
+	if err != nil {
+		return err
+	}
+
+	force, err = getBoolEnv("FORCE")
+	if err != nil {
+		return err
+	}
+
+	maxBackfill, err = getIntEnv("MAX_BACKFILL", 10)
+	if err != nil {
+		return err
+	}
+	if maxBackfill < 1 {
+		return errors.New("Environment variable 'MAX_BACKFILL' must be a positive integer.")
+	}
+
+	if value := os.Getenv("GRACE_PERIOD"); value != "" {
+		gracePeriod, err = time.ParseDuration(value)
+		if err != nil || gracePeriod < 0 {
+			return errors.New("Environment variable 'GRACE_PERIOD' must be a non-negative duration, for example '5m'.")
+		}
+	}
+
+	summaryFile = os.Getenv("SUMMARY_FILE")
+
+	postHook = os.Getenv("POST_HOOK")
+
+	defaultAssignee = os.Getenv("DEFAULT_ASSIGNEE")
+
+	validateAssignees, err = getBoolEnv("VALIDATE_ASSIGNEES")
+	if err != nil {
+		return err
+	}
+
+	if file := os.Getenv("ONCALL_ROTATION_FILE"); file != "" {
+		onCallRotation, err = loadRotation(file)
+		if err != nil {
+			return fmt.Errorf("Environment variable 'ONCALL_ROTATION_FILE' must name a valid rotation file: %w", err)
+		}
+	}
+
+	notifyWebhookURL = os.Getenv("NOTIFY_WEBHOOK")
+	pushgatewayURL = os.Getenv("PUSHGATEWAY_URL")
+
+	linkPrevious, err = getBoolEnv("LINK_PREVIOUS")
+	if err != nil {
+		return err
+	}
+
+	strict, err = getBoolEnv("STRICT")
+	if err != nil {
+		return err
+	}
+
+	rollWeekendDue, err = getBoolEnv("ROLL_WEEKEND_DUE")
+	if err != nil {
+		return err
+	}
+
+	closePrevious, err = getBoolEnv("CLOSE_PREVIOUS")
+	if err != nil {
+		return err
+	}
+
+	expandEnv, err = getBoolEnv("EXPAND_ENV")
+	if err != nil {
+		return err
+	}
+
+	appendFooter, err = getBoolEnv("APPEND_FOOTER")
+	if err != nil {
+		return err
+	}
+
+	if project := os.Getenv("TRIAGE_PROJECT"); project != "" {
+		triageProject = project
+	}
+
+	createLabels, err = getBoolEnv("CREATE_LABELS")
+	if err != nil {
+		return err
+	}
+
+	if color := os.Getenv("LABEL_COLOR"); color != "" {
+		labelColor = color
+	}
+
+	maxDescriptionBytes, err = getIntEnv("MAX_DESCRIPTION_BYTES", 1048576)
+	if err != nil {
+		return err
+	}
+	if maxDescriptionBytes < 1 {
+		return errors.New("Environment variable 'MAX_DESCRIPTION_BYTES' must be a positive integer.")
+	}
+
+	maxRetries, err = getIntEnv("MAX_RETRIES", 3)
+	if err != nil {
+		return err
+	}
+
+	concurrency, err = getIntEnv("CONCURRENCY", 4)
+	if err != nil {
+		return err
+	}
+
+	rateLimit, err = getIntEnv("RATE_LIMIT", 0)
+	if err != nil {
+		return err
+	}
+
+	if mode := os.Getenv("CREATED_AT_MODE"); mode != "" {
+		createdAtMode = mode
+	}
+	if createdAtMode != "occurrence" && createdAtMode != "now" {
+		return errors.New("Environment variable 'CREATED_AT_MODE' must be either 'occurrence' or 'now'.")
+	}
+
+	if mode := os.Getenv("FIRST_RUN"); mode != "" {
+		firstRun = mode
+	}
+	if firstRun != "schedule" && firstRun != "skip" && firstRun != "create" {
+		return errors.New("Environment variable 'FIRST_RUN' must be one of 'schedule', 'skip', or 'create'.")
+	}
+
+	if backend := os.Getenv("STATE_BACKEND"); backend != "" {
+		stateBackend = backend
+	}
+	if stateBackend != "pipeline" && stateBackend != "file" {
+		return errors.New("Environment variable 'STATE_BACKEND' must be either 'pipeline' or 'file'.")
+	}
+
+	if source := os.Getenv("TEMPLATES_SOURCE"); source != "" {
+		templatesSource = source
+	}
+	if templatesSource != "filesystem" && templatesSource != "api" {
+		return errors.New("Environment variable 'TEMPLATES_SOURCE' must be either 'filesystem' or 'api'.")
+	}
+
+	templatesRef = os.Getenv("TEMPLATES_REF")
+	if templatesRef == "" {
+		templatesRef = os.Getenv("CI_DEFAULT_BRANCH")
+	}
+	if templatesSource == "api" && templatesRef == "" {
+		return errors.New("Environment variable 'TEMPLATES_REF' must be set when TEMPLATES_SOURCE is 'api'.")
+	}
+
+	if ref, ok := os.LookupEnv("PIPELINE_REF"); ok {
+		pipelineRef = ref
+	} else {
+		pipelineRef = os.Getenv("CI_DEFAULT_BRANCH")
+	}
+
+	if file := os.Getenv("ARTIFACT_PATH"); file != "" {
+		artifactPath = file
+	}
+
+	if file := os.Getenv("STATE_FILE"); file != "" {
+		stateFile = file
+	}
+
+	if value := os.Getenv("CI_API_V4_URL"); value != "" {
+		ciAPIV4URL = value
+	}
+	if ciAPIV4URL == "" {
+		return errors.New("Environment variable 'CI_API_V4_URL' not found. This tool must be ran as part of a GitLab pipeline or with a --config file.")
+	}
+
+	if value := os.Getenv("CI_PROJECT_ID"); value != "" {
+		ciProjectID = value
+	}
+	if ciProjectID == "" {
+		return errors.New("Environment variable 'CI_PROJECT_ID' not found. This tool must be ran as part of a GitLab pipeline or with a --config file.")
+	}
+	if !validProjectID(ciProjectID) {
+		return errors.New("Environment variable 'CI_PROJECT_ID' must be a numeric project ID or a project path such as 'group/project'.")
+	}
+
+	if value := os.Getenv("CI_PROJECT_DIR"); value != "" {
+		ciProjectDir = value
+	}
+	if ciProjectDir == "" {
+		return errors.New("Environment variable 'CI_PROJECT_DIR' not found. This tool must be ran as part of a GitLab pipeline or with a --config file.")
+	}
+
+	if value := os.Getenv("CI_JOB_NAME"); value != "" {
+		ciJobName = value
+	}
+	if ciJobName == "" && stateBackend == "pipeline" {
+		return errors.New("Environment variable 'CI_JOB_NAME' not found. This tool must be ran as part of a GitLab pipeline or with a --config file.")
+	}
+
+	return nil
+}
+
+func resolveTemplatesDir(projectDir string, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = path.Join(projectDir, dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Templates directory '%s' not found. Create it or set TEMPLATES_DIR to the directory containing your issue templates.", dir)
+	}
+
+	return dir, nil
+}
+
+func run() int {
+	forceFlag := flag.Bool("force", false, "Create an issue from every enabled template, regardless of the last run time")
+	templatesDirFlag := flag.String("templates-dir", "", "The directory containing the issue templates, relative to the project directory")
+	validateFlag := flag.Bool("validate", false, "Check every template for errors without creating any issues")
+	listFlag := flag.Bool("list-templates", false, "Print a table of every template and its next occurrence without creating any issues")
+	jsonFlag := flag.Bool("json", false, "Print --list-templates output as JSON")
+	explainFlag := flag.String("explain", "", "Print the settings of the named template after defaults are applied, without creating any issues")
+	previewFlag := flag.Int("preview", 0, "Print the next N occurrences of every enabled template without creating any issues")
+	configFlag := flag.String("config", "", "A YAML file of settings to use instead of the GitLab CI/CD environment variables")
+	flag.Parse()
+
+	if *configFlag != "" {
+		err := loadConfigFile(*configFlag)
+		if err != nil {
+			log.Println("Error:", err)
+			return exitConfigError
+		}
+	}
+
+	if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		issuesRelativePath = dir
+	}
+
+	if *templatesDirFlag != "" {
+		issuesRelativePath = *templatesDirFlag
+	}
+
+	if dir := os.Getenv("CI_PROJECT_DIR"); dir != "" {
+		ciProjectDir = dir
+	}
+
+	if root := os.Getenv("INCLUDE_ROOT"); root != "" {
+		includeRoot = root
+	}
+	if includeRoot != "templates" && includeRoot != "repository" {
+		log.Println("Error: Environment variable 'INCLUDE_ROOT' must be either 'templates' or 'repository'.")
+		return exitConfigError
+	}
+
+	err := loadScheduleEnvironment()
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	if *validateFlag {
+		return runValidation(ciProjectDir)
+	}
+
+	if *listFlag {
+		return runListTemplates(ciProjectDir, *jsonFlag)
+	}
+
+	if *previewFlag > 0 {
+		return runPreview(ciProjectDir, *previewFlag)
+	}
+
+	if *explainFlag != "" {
+		return runExplain(ciProjectDir, *explainFlag)
+	}
+
+	err = loadEnvironment()
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	if *forceFlag {
+		force = true
+	}
+
+	git, err := newGitLabClient()
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	err = checkToken(git, "GITLAB_API_TOKEN")
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	if templatesSource == "api" {
+		issuesRelativePath, err = fetchTemplates(git, ciProjectID, issuesRelativePath, templatesRef)
+		if err != nil {
+			log.Println("Error: unable to fetch templates -", err)
+			return exitConfigError
+		}
+		defer os.RemoveAll(issuesRelativePath)
+	} else {
+		issuesRelativePath, err = resolveTemplatesDir(ciProjectDir, issuesRelativePath)
+		if err != nil {
+			log.Println("Error:", err)
+			return exitConfigError
+		}
+	}
+
+	runTime := time.Now()
+
+	if !filepath.IsAbs(stateFile) {
+		stateFile = path.Join(ciProjectDir, stateFile)
+	}
+
+	if !filepath.IsAbs(artifactPath) {
+		artifactPath = path.Join(ciProjectDir, artifactPath)
+	}
+
+	var state *runState
+	if stateBackend == "file" {
+		state, err = readStateFile(stateFile)
+	} else {
+		var lastRunTime time.Time
+		lastRunTime, err = getLastRunTime(git)
+		state = newRunState(lastRunTime)
+	}
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	log.Println("Last run:", state.LastRun.Format(time.RFC3339))
+
+	summary := newRunSummary()
+
+	err = processTemplates(git, issuesRelativePath, state, summary)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	if summaryFile != "" {
+		err = summary.write(summaryFile)
+		if err != nil {
+			log.Println("Warning: unable to write run summary -", err)
+		}
+	}
+
+	err = summary.writeArtifact(artifactPath)
+	if err != nil {
+		log.Println("Warning: unable to write created issues to", artifactPath, "-", err)
+	}
+
+	if postHook != "" {
+		output, err := runPostHook(postHook, summary)
+		if output != "" {
+			log.Println("Post hook output:", output)
+		}
+		if err != nil {
+			log.Println("Warning: post hook", postHook, "failed -", err)
+		}
+	}
+
+	if pushgatewayURL != "" {
+		err = pushMetrics(pushgatewayURL, summary, time.Since(runTime))
+		if err != nil {
+			log.Println("Warning: unable to push metrics -", err)
+		}
+	}
+
+	if stateBackend == "file" && !dryRun {
+		err = state.write(stateFile, runTime)
+		if err != nil {
+			log.Println("Error: unable to write state file -", err)
+			return exitConfigError
+		}
+	}
+
+	if len(summary.Errors) > 0 {
+		log.Println("Run complete with", len(summary.Errors), "failed template(s):")
+		for _, failure := range summary.Errors {
+			log.Println(" -", failure.Path+":", failure.Error)
+		}
+	} else {
+		log.Println("Run complete")
+	}
+
+	return exitCode(summary)
+}
+
+func exitCode(summary *runSummary) int {
+	if len(summary.Errors) > 0 {
+		return exitTemplatesFailed
+	}
+
+	return exitOK
+}
+
+func main() {
+	os.Exit(run())
+}
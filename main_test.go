@@ -1,10 +1,38 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xanzy/go-gitlab"
 )
 
+func newTestClient(t *testing.T, mux *http.ServeMux) *client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	git, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newClient(git)
+}
+
 func Test_parseMetadata(t *testing.T) {
 	type args struct {
 		contents []byte
@@ -42,7 +70,17 @@ confidential: true
 ---
 `)},
 			want: &metadata{
-				Confidential: true,
+				Confidential: gitlab.Bool(true),
+			},
+		},
+		{
+			name: "Parses explicit false confidential",
+			args: args{contents: ([]byte)(`---
+confidential: false
+---
+`)},
+			want: &metadata{
+				Confidential: gitlab.Bool(false),
 			},
 		},
 		{
@@ -85,6 +123,298 @@ labels: [ "label1", "label2" ]
 				Labels: []string{"label1", "label2"},
 			},
 		},
+		{
+			name: "Parses project",
+			args: args{contents: ([]byte)(`---
+project: group/project
+---
+`)},
+			want: &metadata{
+				Project: "group/project",
+			},
+		},
+		{
+			name: "Parses group",
+			args: args{contents: ([]byte)(`---
+group: mygroup
+---
+`)},
+			want: &metadata{
+				Group: "mygroup",
+			},
+		},
+		{
+			name: "Parses author",
+			args: args{contents: ([]byte)(`---
+author: service-account
+---
+`)},
+			want: &metadata{
+				Author: "service-account",
+			},
+		},
+		{
+			name: "Parses milestone",
+			args: args{contents: ([]byte)(`---
+milestone: "v1.0"
+---
+`)},
+			want: &metadata{
+				Milestone: "v1.0",
+			},
+		},
+		{
+			name: "Parses epic",
+			args: args{contents: ([]byte)(`---
+epic: "Quarterly planning"
+---
+`)},
+			want: &metadata{
+				Epic: "Quarterly planning",
+			},
+		},
+		{
+			name: "Parses weight",
+			args: args{contents: ([]byte)(`---
+weight: 3
+---
+`)},
+			want: &metadata{
+				Weight: gitlab.Int(3),
+			},
+		},
+		{
+			name: "Parses issue type",
+			args: args{contents: ([]byte)(`---
+issuetype: incident
+---
+`)},
+			want: &metadata{
+				IssueType: "incident",
+			},
+		},
+		{
+			name: "Parses health status",
+			args: args{contents: ([]byte)(`---
+healthstatus: on_track
+---
+`)},
+			want: &metadata{
+				HealthStatus: "on_track",
+			},
+		},
+		{
+			name: "Parses estimate",
+			args: args{contents: ([]byte)(`---
+estimate: 4h
+---
+`)},
+			want: &metadata{
+				Estimate: "4h",
+			},
+		},
+		{
+			name: "Parses description file",
+			args: args{contents: ([]byte)(`---
+descriptionfile: common/description.md
+---
+`)},
+			want: &metadata{
+				DescriptionFile: "common/description.md",
+			},
+		},
+		{
+			name: "Parses start date",
+			args: args{contents: ([]byte)(`---
+startdate: 2020-02-01
+---
+`)},
+			want: &metadata{
+				StartDate: "2020-02-01",
+			},
+		},
+		{
+			name: "Parses end date",
+			args: args{contents: ([]byte)(`---
+enddate: 2020-03-31
+---
+`)},
+			want: &metadata{
+				EndDate: "2020-03-31",
+			},
+		},
+		{
+			name: "Parses jitter",
+			args: args{contents: ([]byte)(`---
+jitter: 15m
+---
+`)},
+			want: &metadata{
+				Jitter: "15m",
+			},
+		},
+		{
+			name: "Parses iteration",
+			args: args{contents: ([]byte)(`---
+iteration: auto
+---
+`)},
+			want: &metadata{
+				Iteration: "auto",
+			},
+		},
+		{
+			name: "Parses assignee strategy",
+			args: args{contents: ([]byte)(`---
+assignee_strategy: round-robin
+assignee_pool: ["alice", "bob"]
+---
+`)},
+			want: &metadata{
+				AssigneeStrategy: "round-robin",
+				AssigneePool:     []string{"alice", "bob"},
+			},
+		},
+		{
+			name: "Parses due time",
+			args: args{contents: ([]byte)(`---
+duein: 30h
+duetime: true
+---
+`)},
+			want: &metadata{
+				DueIn:   "30h",
+				DueTime: gitlab.Bool(true),
+			},
+		},
+		{
+			name: "Parses instance",
+			args: args{contents: ([]byte)(`---
+instance: mirror
+project: group/project
+---
+`)},
+			want: &metadata{
+				Instance: "mirror",
+				Project:  "group/project",
+			},
+		},
+		{
+			name: "Parses subscribers",
+			args: args{contents: ([]byte)(`---
+subscribers: ["alice", 42]
+---
+`)},
+			want: &metadata{
+				Subscribers: []string{"alice", "42"},
+			},
+		},
+		{
+			name: "Parses append date",
+			args: args{contents: ([]byte)(`---
+append_date: true
+date_format: "02 Jan 2006"
+---
+`)},
+			want: &metadata{
+				AppendDate: gitlab.Bool(true),
+				DateFormat: "02 Jan 2006",
+			},
+		},
+		{
+			name: "Parses max occurrences",
+			args: args{contents: ([]byte)(`---
+maxoccurrences: 5
+---
+`)},
+			want: &metadata{
+				MaxOccurrences: 5,
+			},
+		},
+		{
+			name: "Parses mentions",
+			args: args{contents: ([]byte)(`---
+mentions: ["alice", "@my-group/oncall"]
+---
+`)},
+			want: &metadata{
+				Mentions: []string{"alice", "@my-group/oncall"},
+			},
+		},
+		{
+			name: "Parses carry over",
+			args: args{contents: ([]byte)(`---
+carryover: true
+---
+`)},
+			want: &metadata{
+				CarryOver: gitlab.Bool(true),
+			},
+		},
+		{
+			name: "Parses use template",
+			args: args{contents: ([]byte)(`---
+usetemplate: Bug
+---
+`)},
+			want: &metadata{
+				UseTemplate: "Bug",
+			},
+		},
+		{
+			name: "Parses quick actions",
+			args: args{contents: ([]byte)(`---
+quickactions: false
+---
+`)},
+			want: &metadata{
+				QuickActions: gitlab.Bool(false),
+			},
+		},
+		{
+			name: "Parses blocking relationships",
+			args: args{contents: ([]byte)(`---
+blocks: 12
+blockedby: 7
+---
+`)},
+			want: &metadata{
+				Blocks:    12,
+				BlockedBy: 7,
+			},
+		},
+		{
+			name: "Parses precondition",
+			args: args{contents: ([]byte)(`---
+precondition_url: https://deploy.example.com/status
+precondition_status: 204
+---
+`)},
+			want: &metadata{
+				PreconditionURL:    "https://deploy.example.com/status",
+				PreconditionStatus: 204,
+			},
+		},
+		{
+			name: "Parses enabled",
+			args: args{contents: ([]byte)(`---
+enabled: false
+---
+`)},
+			want: &metadata{
+				Enabled: gitlab.Bool(false),
+			},
+		},
+		{
+			name: "Parses timezone",
+			args: args{contents: ([]byte)(`---
+timezone: Europe/London
+---
+`)},
+			want: &metadata{
+				Timezone: "Europe/London",
+			},
+		},
 		{
 			name: "Parses dueindays",
 			args: args{contents: ([]byte)(`---
@@ -95,6 +425,46 @@ duein: 24h
 				DueIn: "24h",
 			},
 		},
+		{
+			name: "Parses duedate",
+			args: args{contents: ([]byte)(`---
+duedate: 2020-01-15
+---
+`)},
+			want: &metadata{
+				DueDate: "2020-01-15",
+			},
+		},
+		{
+			name: "Parses duedate offset",
+			args: args{contents: ([]byte)(`---
+duedate: +3d
+---
+`)},
+			want: &metadata{
+				DueDate: "+3d",
+			},
+		},
+		{
+			name: "Parses single crontab",
+			args: args{contents: ([]byte)(`---
+crontab: "@daily"
+---
+`)},
+			want: &metadata{
+				Crontab: crontabs{"@daily"},
+			},
+		},
+		{
+			name: "Parses crontab list",
+			args: args{contents: ([]byte)(`---
+crontab: [ "0 0 1 * *", "0 0 15 * *" ]
+---
+`)},
+			want: &metadata{
+				Crontab: crontabs{"0 0 1 * *", "0 0 15 * *"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -109,3 +479,3832 @@ duein: 24h
 		})
 	}
 }
+
+func Test_buildIssueOptions_assignees(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("username") {
+		case "assignee1":
+			fmt.Fprint(w, `[{"id":1,"username":"assignee1"}]`)
+		case "assignee2":
+			fmt.Fprint(w, `[{"id":2,"username":"assignee2"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	git := newTestClient(t, mux)
+
+	data, err := parseMetadata([]byte(`---
+assignees: [ "assignee1", "unknown", 42, "assignee2", "7" ]
+---
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{1, 42, 2, 7}
+	if !reflect.DeepEqual(options.AssigneeIDs, want) {
+		t.Errorf("buildIssueOptions() AssigneeIDs = %v, want %v", options.AssigneeIDs, want)
+	}
+}
+
+func Test_buildIssueOptions_defaultAssignee(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") == "oncall-bot" {
+			fmt.Fprint(w, `[{"id":9,"username":"oncall-bot"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":1,"username":"assignee1"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(assignee string) { defaultAssignee = assignee }(defaultAssignee)
+
+	tests := []struct {
+		name            string
+		assignees       []string
+		defaultAssignee string
+		want            []int
+	}{
+		{name: "Leaves issue unassigned without a default", want: nil},
+		{name: "Uses the default when the template has no assignees", defaultAssignee: "oncall-bot", want: []int{9}},
+		{name: "Prefers template assignees over the default", assignees: []string{"assignee1"}, defaultAssignee: "oncall-bot", want: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultAssignee = tt.defaultAssignee
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{Assignees: tt.assignees})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options.AssigneeIDs, tt.want) {
+				t.Errorf("buildIssueOptions() AssigneeIDs = %v, want %v", options.AssigneeIDs, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildIssueOptions_onCall(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("username") {
+		case "alice":
+			fmt.Fprint(w, `[{"id":1,"username":"alice"}]`)
+		case "bob":
+			fmt.Fprint(w, `[{"id":2,"username":"bob"}]`)
+		default:
+			fmt.Fprint(w, `[{"id":3,"username":"assignee1"}]`)
+		}
+	})
+	git := newTestClient(t, mux)
+
+	defer func(r *rotation) { onCallRotation = r }(onCallRotation)
+
+	oncall := &rotation{Start: "2020-01-06", Weeks: 1, Members: []string{"alice", "bob"}, start: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name     string
+		rotation *rotation
+		nextTime time.Time
+		want     []int
+	}{
+		{name: "Assigns the member on call at the occurrence", rotation: oncall, nextTime: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC), want: []int{2, 3}},
+		{name: "Skips the on-call assignee without a rotation", nextTime: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC), want: []int{3}},
+		{name: "Skips the on-call assignee before the rotation starts", rotation: oncall, nextTime: time.Date(2019, 12, 30, 9, 0, 0, 0, time.UTC), want: []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onCallRotation = tt.rotation
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{Assignees: []string{"@oncall", "assignee1"}, NextTime: tt.nextTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options.AssigneeIDs, tt.want) {
+				t.Errorf("buildIssueOptions() AssigneeIDs = %v, want %v", options.AssigneeIDs, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildIssueOptions_roundRobin(t *testing.T) {
+	var previous int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("username") {
+		case "alice":
+			fmt.Fprint(w, `[{"id":1,"username":"alice"}]`)
+		case "bob":
+			fmt.Fprint(w, `[{"id":2,"username":"bob"}]`)
+		case "carol":
+			fmt.Fprint(w, `[{"id":3,"username":"carol"}]`)
+		default:
+			fmt.Fprint(w, `[{"id":4,"username":"assignee1"}]`)
+		}
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("labels") != "recurring::weekly" {
+			t.Errorf("labels = %v, want recurring::weekly", r.URL.Query().Get("labels"))
+		}
+		w.Header().Set("X-Total", strconv.Itoa(previous))
+		fmt.Fprint(w, `[{"iid":1}]`)
+	})
+	git := newTestClient(t, mux)
+
+	tests := []struct {
+		name     string
+		previous int
+		pool     []string
+		want     []int
+	}{
+		{name: "Assigns the first member before any issues", previous: 0, pool: []string{"alice", "bob", "carol"}, want: []int{1}},
+		{name: "Assigns the next member after each issue", previous: 1, pool: []string{"alice", "bob", "carol"}, want: []int{2}},
+		{name: "Starts again from the first member", previous: 3, pool: []string{"alice", "bob", "carol"}, want: []int{1}},
+		{name: "Keeps the assignees with an empty pool", previous: 2, want: []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous = tt.previous
+
+			data := &metadata{Template: "weekly", Assignees: []string{"assignee1"}, AssigneeStrategy: "round-robin", AssigneePool: tt.pool}
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options.AssigneeIDs, tt.want) {
+				t.Errorf("buildIssueOptions() AssigneeIDs = %v, want %v", options.AssigneeIDs, tt.want)
+			}
+		})
+	}
+
+	_, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{AssigneeStrategy: "random"})
+	if err == nil {
+		t.Errorf("buildIssueOptions() error = nil, want an error for an unknown assignee_strategy")
+	}
+}
+
+func Test_buildIssueOptions_createdAt(t *testing.T) {
+	git := newTestClient(t, http.NewServeMux())
+
+	defer func(mode string) { createdAtMode = mode }(createdAtMode)
+
+	nextTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		mode string
+		want *time.Time
+	}{
+		{name: "Uses the occurrence time", mode: "occurrence", want: &nextTime},
+		{name: "Leaves creation time to GitLab", mode: "now", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAtMode = tt.mode
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{NextTime: nextTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(options.CreatedAt, tt.want) {
+				t.Errorf("buildIssueOptions() CreatedAt = %v, want %v", options.CreatedAt, tt.want)
+			}
+		})
+	}
+}
+
+func Test_subscribeUsers(t *testing.T) {
+	var subscribed []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") == "alice" {
+			fmt.Fprint(w, `[{"id":1,"username":"alice"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/5/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("subscribeUsers() method = %v, want POST", r.Method)
+		}
+		sudo := r.Header.Get("SUDO")
+		subscribed = append(subscribed, sudo)
+		if sudo == "42" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, `{"id":10,"iid":5,"subscribed":true}`)
+	})
+	git := newTestClient(t, mux)
+
+	warnings := &warningLog{}
+	subscribeUsers(git, 1, &gitlab.Issue{IID: 5}, []string{"alice", "unknown", "42"}, warnings)
+
+	if want := []string{"1", "42"}; !reflect.DeepEqual(subscribed, want) {
+		t.Errorf("subscribeUsers() subscribed = %v, want %v", subscribed, want)
+	}
+	if messages := warnings.reset(); len(messages) != 1 || !strings.Contains(messages[0], "subscriber unknown not found") {
+		t.Errorf("subscribeUsers() warnings = %v, want one for the unknown subscriber", messages)
+	}
+}
+
+func Test_warnNonMemberAssignees(t *testing.T) {
+	var pages []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/members/all", func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		if page == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":1,"username":"member1"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":2,"username":"member2"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	defer log.SetOutput(os.Stderr)
+
+	err := warnNonMemberAssignees(git, 1, []int{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("warnNonMemberAssignees() pages = %v, want [1 2]", pages)
+	}
+	if strings.Count(buffer.String(), "is not a member") != 1 || !strings.Contains(buffer.String(), "assignee 3 ") {
+		t.Errorf("warnNonMemberAssignees() logged %q, want a warning for assignee 3 only", buffer.String())
+	}
+}
+
+func Test_buildIssueOptions_labels(t *testing.T) {
+	git := newTestClient(t, http.NewServeMux())
+
+	data, err := parseMetadata([]byte(`---
+labels: [ "label1", "label2" ]
+---
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &gitlab.Labels{"label1", "label2"}
+	if !reflect.DeepEqual(options.Labels, want) {
+		t.Errorf("buildIssueOptions() Labels = %v, want %v", options.Labels, want)
+	}
+}
+
+func Test_resolveMilestone(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/milestones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("title") == "project milestone" {
+			fmt.Fprint(w, `[{"id":10,"title":"project milestone"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v4/groups/2/milestones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":20,"title":"group milestone"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":21,"title":"group milestone 2"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	project := &gitlab.Project{ID: 1, Namespace: &gitlab.ProjectNamespace{ID: 2, Kind: "group"}}
+
+	tests := []struct {
+		name    string
+		title   string
+		want    int
+		wantErr bool
+	}{
+		{name: "Resolves project milestone", title: "project milestone", want: 10},
+		{name: "Resolves group milestone from a later page", title: "group milestone 2", want: 21},
+		{name: "Errors on unknown milestone", title: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveMilestone(git, project, tt.title)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveMilestone() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveMilestone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildIssueOptions_weight(t *testing.T) {
+	git := newTestClient(t, http.NewServeMux())
+
+	tests := []struct {
+		name     string
+		contents []byte
+		want     *int
+	}{
+		{
+			name: "Sets weight",
+			contents: ([]byte)(`---
+weight: 3
+---
+`),
+			want: gitlab.Int(3),
+		},
+		{
+			name: "Leaves weight unset when omitted",
+			contents: ([]byte)(`---
+title: Test Title
+---
+`),
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := parseMetadata(tt.contents)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(options.Weight, tt.want) {
+				t.Errorf("buildIssueOptions() Weight = %v, want %v", options.Weight, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hasDuplicateIssue(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		maxRetries, retryDelay = retries, delay
+	}(maxRetries, retryDelay)
+	maxRetries, retryDelay = 3, time.Millisecond
+
+	failures := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"message":"502 Bad Gateway"}`)
+			return
+		}
+		if r.URL.Query().Get("created_after") != "2020-01-01T00:00:00Z" || r.URL.Query().Get("created_before") != "2020-01-02T00:00:00Z" {
+			t.Errorf("unexpected dedup window %v", r.URL.Query())
+		}
+		fmt.Fprint(w, `[{"id":1,"iid":1,"title":"Daily reminder"},{"id":2,"iid":2,"title":"Daily reminder (copy)"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	tests := []struct {
+		name     string
+		title    string
+		failures int
+		want     bool
+	}{
+		{name: "Detects identical title", title: "Daily reminder", want: true},
+		{name: "Ignores partial title match", title: "Daily", want: false},
+		{name: "Retries a transient failure", title: "Daily reminder", failures: 1, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures = tt.failures
+
+			data := &metadata{
+				Title:     tt.title,
+				NextTime:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				PeriodEnd: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			}
+
+			got, err := hasDuplicateIssue(git, 1, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("hasDuplicateIssue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func setEnv(t *testing.T, env map[string]string) {
+	for key, value := range env {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+func clearConfig(t *testing.T) {
+	url, token, id, dir, job, templates := ciAPIV4URL, gitlabAPIToken, ciProjectID, ciProjectDir, ciJobName, issuesRelativePath
+	t.Cleanup(func() {
+		ciAPIV4URL, gitlabAPIToken, ciProjectID, ciProjectDir, ciJobName, issuesRelativePath = url, token, id, dir, job, templates
+	})
+
+	ciAPIV4URL, gitlabAPIToken, ciProjectID, ciProjectDir, ciJobName = "", "", "", "", ""
+}
+
+func Test_validProjectID(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "Accepts a numeric ID", value: "42", want: true},
+		{name: "Accepts a project path", value: "group/project", want: true},
+		{name: "Accepts a project path in a subgroup", value: "group/subgroup/project", want: true},
+		{name: "Rejects a zero ID", value: "0", want: false},
+		{name: "Rejects a negative ID", value: "-1", want: false},
+		{name: "Rejects a project name without a namespace", value: "project", want: false},
+		{name: "Rejects an empty path segment", value: "group//project", want: false},
+		{name: "Rejects a trailing slash", value: "group/project/", want: false},
+		{name: "Rejects whitespace", value: "group/my project", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validProjectID(tt.value); got != tt.want {
+				t.Errorf("validProjectID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadEnvironment(t *testing.T) {
+	validEnv := map[string]string{
+		"GITLAB_API_TOKEN":    "token",
+		"GITLAB_INSECURE_TLS": "",
+		"CI_API_V4_URL":       "https://gitlab.example.com/api/v4",
+		"CI_PROJECT_ID":       "1",
+		"CI_PROJECT_DIR":      "/builds/project",
+		"CI_JOB_NAME":         "recurring issues",
+	}
+
+	defer func(backend string) { stateBackend = backend }(stateBackend)
+	defer func(source string) { templatesSource = source }(templatesSource)
+	defer func(max int) { maxBackfill = max }(maxBackfill)
+
+	tests := []struct {
+		name        string
+		missing     string
+		backend     string
+		source      string
+		ref         string
+		projectID   string
+		maxBackfill string
+		wantErr     bool
+	}{
+		{name: "Accepts complete environment"},
+		{name: "Requires GITLAB_API_TOKEN", missing: "GITLAB_API_TOKEN", wantErr: true},
+		{name: "Requires CI_API_V4_URL", missing: "CI_API_V4_URL", wantErr: true},
+		{name: "Requires CI_PROJECT_ID", missing: "CI_PROJECT_ID", wantErr: true},
+		{name: "Requires CI_PROJECT_DIR", missing: "CI_PROJECT_DIR", wantErr: true},
+		{name: "Requires CI_JOB_NAME", missing: "CI_JOB_NAME", wantErr: true},
+		{name: "Does not require CI_JOB_NAME with the file state backend", missing: "CI_JOB_NAME", backend: "file"},
+		{name: "Rejects unknown state backend", backend: "database", wantErr: true},
+		{name: "Accepts the api templates source with a ref", source: "api", ref: "main"},
+		{name: "Requires TEMPLATES_REF with the api templates source", missing: "TEMPLATES_REF", source: "api", wantErr: true},
+		{name: "Rejects unknown templates source", source: "git", wantErr: true},
+		{name: "Accepts a project path as CI_PROJECT_ID", projectID: "group/subgroup/project"},
+		{name: "Rejects a project path without a namespace", projectID: "project", wantErr: true},
+		{name: "Accepts a positive MAX_BACKFILL", maxBackfill: "1"},
+		{name: "Rejects a MAX_BACKFILL of zero", maxBackfill: "0", wantErr: true},
+		{name: "Rejects a negative MAX_BACKFILL", maxBackfill: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for key, value := range validEnv {
+				env[key] = value
+			}
+			if tt.missing != "" {
+				env[tt.missing] = ""
+			}
+			env["STATE_BACKEND"] = tt.backend
+			env["TEMPLATES_SOURCE"] = tt.source
+			env["TEMPLATES_REF"] = tt.ref
+			env["CI_DEFAULT_BRANCH"] = ""
+			env["MAX_BACKFILL"] = tt.maxBackfill
+			if tt.projectID != "" {
+				env["CI_PROJECT_ID"] = tt.projectID
+			}
+			setEnv(t, env)
+			clearConfig(t)
+			stateBackend = "pipeline"
+			templatesSource = "filesystem"
+
+			err := loadEnvironment()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadEnvironment() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && tt.missing != "" && !strings.Contains(err.Error(), tt.missing) {
+				t.Errorf("loadEnvironment() error = %v, want mention of %v", err, tt.missing)
+			}
+		})
+	}
+}
+
+func Test_getBoolEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{name: "Defaults to false when unset", value: "", want: false},
+		{name: "Parses true", value: "true", want: true},
+		{name: "Parses false", value: "false", want: false},
+		{name: "Rejects invalid values", value: "maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, map[string]string{"DRY_RUN": tt.value})
+
+			got, err := getBoolEnv("DRY_RUN")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getBoolEnv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getBoolEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scheduleIssue(t *testing.T) {
+	lastTime := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		data     *metadata
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "Defaults to UTC",
+			data:     &metadata{Crontab: crontabs{"0 9 * * *"}},
+			wantNext: time.Date(2020, 7, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Evaluates in the template timezone",
+			data:     &metadata{Crontab: crontabs{"0 9 * * *"}, Timezone: "Europe/London"},
+			wantNext: time.Date(2020, 7, 2, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Picks the soonest of multiple crontabs",
+			data:     &metadata{Crontab: crontabs{"0 0 15 * *", "0 0 1 * *"}},
+			wantNext: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Rejects missing crontab",
+			data:    &metadata{},
+			wantErr: true,
+		},
+		{
+			name:     "Offsets by the template jitter",
+			data:     &metadata{Crontab: crontabs{"0 9 * * *"}, Jitter: "1h", Template: "daily"},
+			wantNext: time.Date(2020, 7, 2, 9, 0, 0, 0, time.UTC).Add(jitterOffset("daily", time.Hour)),
+		},
+		{
+			name:    "Rejects invalid jitter",
+			data:    &metadata{Crontab: crontabs{"0 9 * * *"}, Jitter: "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects unknown timezone",
+			data:    &metadata{Crontab: crontabs{"0 9 * * *"}, Timezone: "Not/AZone"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects invalid crontab",
+			data:    &metadata{Crontab: crontabs{"not a crontab"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scheduleIssue(tt.data, lastTime)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("scheduleIssue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !tt.data.NextTime.Equal(tt.wantNext) {
+				t.Errorf("scheduleIssue() NextTime = %v, want %v", tt.data.NextTime, tt.wantNext)
+			}
+		})
+	}
+}
+
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, contents := range templates {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func Test_processTemplates_continuesAfterFailure(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"a_invalid.md": `---
+title: Invalid
+crontab: "not a crontab"
+---
+`,
+		"b_valid.md": `---
+title: Valid
+crontab: "@yearly"
+---
+`,
+		"c_invalid.md": `---
+title: Invalid
+crontab: "@daily"
+timezone: "Not/AZone"
+---
+`,
+	})
+
+	summary := newRunSummary()
+
+	err := processTemplates(nil, dir, newRunState(time.Now()), summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summary.Errors) != 2 {
+		t.Fatalf("processTemplates() errors = %v, want 2", summary.Errors)
+	}
+	if filepath.Base(summary.Errors[0].Path) != "a_invalid.md" || filepath.Base(summary.Errors[1].Path) != "c_invalid.md" {
+		t.Errorf("processTemplates() errors = %v, want paths of invalid templates", summary.Errors)
+	}
+	if summary.TemplatesScanned != 3 || len(summary.Skipped) != 1 {
+		t.Errorf("processTemplates() scanned = %v, skipped = %v, want 3 and 1", summary.TemplatesScanned, summary.Skipped)
+	}
+}
+
+func Test_parseDueDate(t *testing.T) {
+	from := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "Parses absolute date", value: "2020-01-15", want: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "Parses day offset", value: "+3d", want: time.Date(2020, 1, 4, 9, 0, 0, 0, time.UTC)},
+		{name: "Parses week offset", value: "+2w", want: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{name: "Rejects unknown offset unit", value: "+3m", wantErr: true},
+		{name: "Rejects offset without count", value: "+d", wantErr: true},
+		{name: "Rejects bare plus", value: "+", wantErr: true},
+		{name: "Rejects invalid date", value: "15/01/2020", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDueDate(tt.value, from)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDueDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !time.Time(got).Equal(tt.want) {
+				t.Errorf("parseDueDate() = %v, want %v", time.Time(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDueIn_endOfMonth(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		from    time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "Finds the end of a 31 day month", value: "eom", from: time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC)},
+		{name: "Finds the end of a 30 day month", value: "eom", from: time.Date(2020, 4, 30, 9, 0, 0, 0, time.UTC), want: time.Date(2020, 4, 30, 9, 0, 0, 0, time.UTC)},
+		{name: "Finds the end of a leap year February", value: "eom", from: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC), want: time.Date(2020, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{name: "Finds the end of a common year February", value: "eom", from: time.Date(2021, 2, 1, 9, 0, 0, 0, time.UTC), want: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC)},
+		{name: "Finds the end of December", value: "eom", from: time.Date(2020, 12, 15, 9, 0, 0, 0, time.UTC), want: time.Date(2020, 12, 31, 9, 0, 0, 0, time.UTC)},
+		{name: "Subtracts an offset", value: "eom-3d", from: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC), want: time.Date(2020, 2, 26, 9, 0, 0, 0, time.UTC)},
+		{name: "Rejects an offset after the end of the month", value: "eom+3d", from: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC), wantErr: true},
+		{name: "Rejects an offset without days", value: "eom-d", from: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC), wantErr: true},
+		{name: "Rejects an offset in other units", value: "eom-3w", from: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDueIn(tt.value, tt.from)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDueIn() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseDueIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDueIn(t *testing.T) {
+	friday := time.Date(2020, 1, 17, 9, 0, 0, 0, time.UTC)
+
+	defer func(dates map[string]bool) { holidays = dates }(holidays)
+
+	tests := []struct {
+		name     string
+		value    string
+		holidays map[string]bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{name: "Parses duration", value: "72h", want: time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{name: "Skips the weekend", value: "1bd", want: time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{name: "Spans the weekend", value: "3bd", want: time.Date(2020, 1, 22, 9, 0, 0, 0, time.UTC)},
+		{name: "Skips holidays", value: "3bd", holidays: map[string]bool{"2020-01-20": true}, want: time.Date(2020, 1, 23, 9, 0, 0, 0, time.UTC)},
+		{name: "Allows zero business days", value: "0bd", want: friday},
+		{name: "Rejects invalid business days", value: "xbd", wantErr: true},
+		{name: "Rejects invalid duration", value: "3 days", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holidays = tt.holidays
+
+			got, err := parseDueIn(tt.value, friday)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDueIn() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseDueIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadHolidays(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"holidays.txt": "# Public holidays\n2020-01-01\n\n2020-12-25\n",
+		"invalid.txt":  "25/12/2020\n",
+	})
+
+	got, err := loadHolidays(filepath.Join(dir, "holidays.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"2020-01-01": true, "2020-12-25": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadHolidays() = %v, want %v", got, want)
+	}
+
+	_, err = loadHolidays(filepath.Join(dir, "invalid.txt"))
+	if err == nil {
+		t.Errorf("loadHolidays() error = nil, want error for invalid date")
+	}
+}
+
+func Test_renderTemplate(t *testing.T) {
+	nextTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		data            *metadata
+		wantTitle       string
+		wantDescription string
+		wantErr         bool
+	}{
+		{
+			name:            "Passes through plain text",
+			data:            &metadata{Title: "Weekly report", Description: "No placeholders here"},
+			wantTitle:       "Weekly report",
+			wantDescription: "No placeholders here",
+		},
+		{
+			name:      "Formats NextTime",
+			data:      &metadata{Title: `Weekly report for {{.NextTime.Format "2006-01-02"}}`},
+			wantTitle: "Weekly report for 2020-01-15",
+		},
+		{
+			name:            "Exposes date parts",
+			data:            &metadata{Title: "Report {{.Date}}", Description: "{{.Year}} {{.Month}} week {{.Week}}"},
+			wantTitle:       "Report 2020-01-15",
+			wantDescription: "2020 January week 3",
+		},
+		{
+			name:      "Appends the date to the title",
+			data:      &metadata{Title: "Weekly report", AppendDate: gitlab.Bool(true)},
+			wantTitle: "Weekly report - 2020-01-15",
+		},
+		{
+			name:      "Appends the date in the date format",
+			data:      &metadata{Title: "Report for {{.Month}}", AppendDate: gitlab.Bool(true), DateFormat: "02 Jan 2006"},
+			wantTitle: "Report for January - 15 Jan 2020",
+		},
+		{
+			name:      "Ignores the date format without append date",
+			data:      &metadata{Title: "Weekly report", DateFormat: "02 Jan 2006"},
+			wantTitle: "Weekly report",
+		},
+		{
+			name:    "Rejects invalid template",
+			data:    &metadata{Title: "{{.Unknown"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.data.NextTime = nextTime
+
+			got, err := renderTemplate(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Title != tt.wantTitle {
+				t.Errorf("renderTemplate() Title = %v, want %v", got.Title, tt.wantTitle)
+			}
+			if got.Description != tt.wantDescription {
+				t.Errorf("renderTemplate() Description = %v, want %v", got.Description, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func Test_renderTemplate_include(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"templates/common/escalation.txt": "1. Page the on-call engineer",
+		"docs/runbook.txt":                "1. Follow the runbook",
+	})
+
+	defer func(path string, projectDir string, root string) {
+		issuesRelativePath, ciProjectDir, includeRoot = path, projectDir, root
+	}(issuesRelativePath, ciProjectDir, includeRoot)
+	issuesRelativePath = filepath.Join(dir, "templates")
+	ciProjectDir = dir
+
+	tests := []struct {
+		name        string
+		includeRoot string
+		description string
+		want        string
+		wantErr     bool
+	}{
+		{name: "Inlines included file", description: `Steps:
+{{include "common/escalation.txt"}}`, want: `Steps:
+1. Page the on-call engineer`},
+		{name: "Rejects missing include", description: `{{include "common/missing.txt"}}`, wantErr: true},
+		{name: "Rejects include outside the templates directory", description: `{{include "../docs/runbook.txt"}}`, wantErr: true},
+		{name: "Rejects absolute include", description: `{{include "` + filepath.Join(dir, "docs/runbook.txt") + `"}}`, wantErr: true},
+		{name: "Inlines file from the repository root", includeRoot: "repository", description: `{{include "docs/runbook.txt"}}`, want: `1. Follow the runbook`},
+		{name: "Rejects include outside the repository", includeRoot: "repository", description: `{{include "../secret.txt"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includeRoot = "templates"
+			if tt.includeRoot != "" {
+				includeRoot = tt.includeRoot
+			}
+
+			got, err := renderTemplate(&metadata{Description: tt.description})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("renderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.Description != tt.want {
+				t.Errorf("renderTemplate() Description = %v, want %v", got.Description, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expandEnvironment(t *testing.T) {
+	setEnv(t, map[string]string{"CI_PIPELINE_URL": "https://gitlab.example.com/group/project/-/pipelines/1"})
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "Expands variable", text: "Created by $CI_PIPELINE_URL", want: "Created by https://gitlab.example.com/group/project/-/pipelines/1"},
+		{name: "Expands braced variable", text: "Created by ${CI_PIPELINE_URL}.", want: "Created by https://gitlab.example.com/group/project/-/pipelines/1."},
+		{name: "Escapes dollar signs", text: "Budget: $$100", want: "Budget: $100"},
+		{name: "Expands unset variable to nothing", text: "Value: $RECURRING_ISSUES_UNSET", want: "Value: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandEnvironment(tt.text); got != tt.want {
+				t.Errorf("expandEnvironment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_catchUp(t *testing.T) {
+	var createdAt []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				CreatedAt string `json:"created_at"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			createdAt = append(createdAt, body.CreatedAt)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"daily.md": `---
+title: Daily
+crontab: "0 0 * * *"
+---
+`,
+	})
+
+	defer func(id string, enabled bool, max int) {
+		ciProjectID, catchUp, maxBackfill = id, enabled, max
+	}(ciProjectID, catchUp, maxBackfill)
+	ciProjectID = "1"
+
+	lastTime := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -5)
+
+	tests := []struct {
+		name        string
+		catchUp     bool
+		maxBackfill int
+		want        []string
+	}{
+		{
+			name: "Creates a single issue by default",
+			want: []string{lastTime.AddDate(0, 0, 1).Format(time.RFC3339)},
+		},
+		{
+			name:        "Creates missed occurrences up to the cap",
+			catchUp:     true,
+			maxBackfill: 3,
+			want: []string{
+				lastTime.AddDate(0, 0, 1).Format(time.RFC3339),
+				lastTime.AddDate(0, 0, 2).Format(time.RFC3339),
+				lastTime.AddDate(0, 0, 3).Format(time.RFC3339),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt = nil
+			catchUp, maxBackfill = tt.catchUp, tt.maxBackfill
+
+			err := processTemplate(git, lastTime, filepath.Join(dir, "daily.md"), newDefaultsLoader(), newRunSummary())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(createdAt, tt.want) {
+				t.Errorf("processTemplate() created = %v, want %v", createdAt, tt.want)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_force(t *testing.T) {
+	var createdAt []time.Time
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				CreatedAt time.Time `json:"created_at"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			createdAt = append(createdAt, body.CreatedAt)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"yearly.md": `---
+title: Yearly
+crontab: "@yearly"
+---
+`,
+	})
+
+	defer func(id string, enabled bool, mode string) {
+		ciProjectID, force, firstRun = id, enabled, mode
+	}(ciProjectID, force, firstRun)
+	ciProjectID = "1"
+
+	// The next @yearly occurrence after now
+	nextYear := time.Date(time.Now().UTC().Year()+1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		force    bool
+		firstRun string
+		lastTime time.Time
+		want     []time.Time
+	}{
+		{name: "Skips templates that are not due", force: false, firstRun: "create", lastTime: time.Now()},
+		{name: "Creates templates that are not due when forced", force: true, firstRun: "create", lastTime: time.Now(), want: []time.Time{nextYear}},
+		{name: "Skips templates on the first run with FIRST_RUN skip", force: false, firstRun: "skip", lastTime: time.Unix(0, 0)},
+		{name: "Creates the next occurrence on the first run when forced with FIRST_RUN skip", force: true, firstRun: "skip", lastTime: time.Unix(0, 0), want: []time.Time{nextYear}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt = nil
+			force = tt.force
+			firstRun = tt.firstRun
+
+			err := processTemplate(git, tt.lastTime, filepath.Join(dir, "yearly.md"), newDefaultsLoader(), newRunSummary())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(createdAt) != len(tt.want) {
+				t.Fatalf("processTemplate() created = %v, want %v", createdAt, tt.want)
+			}
+			for i := range createdAt {
+				if !createdAt[i].Equal(tt.want[i]) {
+					t.Errorf("processTemplate() created_at = %v, want %v", createdAt[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_processTemplate_lastCreated(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var previous string
+	created := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			created++
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		if r.URL.Query().Get("labels") == "recurring::daily" && r.URL.Query().Get("order_by") == "created_at" {
+			fmt.Fprint(w, previous)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"daily.md": `---
+title: Daily
+crontab: "0 0 * * *"
+---
+`,
+	})
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name       string
+		previous   string
+		want       int
+		wantReason string
+	}{
+		{
+			name:     "Creates the occurrence missed since the last run",
+			previous: `[]`,
+			want:     1,
+		},
+		{
+			name:       "Skips a rerun within the window of an existing issue",
+			previous:   `[{"iid":1,"created_at":"` + today.Format(time.RFC3339) + `"}]`,
+			want:       0,
+			wantReason: "not due",
+		},
+		{
+			name:     "Uses the last run when it is later than the last issue",
+			previous: `[{"iid":1,"created_at":"` + today.AddDate(0, 0, -5).Format(time.RFC3339) + `"}]`,
+			want:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous = tt.previous
+			created = 0
+			summary := newRunSummary()
+
+			err := processTemplate(git, today.AddDate(0, 0, -1).Add(time.Hour), filepath.Join(dir, "daily.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != tt.want {
+				t.Errorf("processTemplate() created = %v, want %v", created, tt.want)
+			}
+			if tt.wantReason != "" && (len(summary.Skipped) != 1 || summary.Skipped[0].Reason != tt.wantReason) {
+				t.Errorf("processTemplate() skipped = %v, want %v", summary.Skipped, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_gracePeriod(t *testing.T) {
+	var descriptions []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Description string `json:"description"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			descriptions = append(descriptions, body.Description)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+
+		var issues []map[string]interface{}
+		if r.URL.Query().Get("in") == "description" {
+			for _, description := range descriptions {
+				issues = append(issues, map[string]interface{}{"iid": 1, "description": description})
+			}
+		}
+		json.NewEncoder(w).Encode(issues)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"minutely.md": `---
+title: Minutely
+crontab: "* * * * *"
+---
+`,
+	})
+
+	defer func(id string, grace time.Duration) { ciProjectID, gracePeriod = id, grace }(ciProjectID, gracePeriod)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name       string
+		grace      time.Duration
+		runs       int
+		want       int
+		wantReason string
+	}{
+		{name: "Skips an occurrence just ahead without a grace period", grace: 0, runs: 1, want: 0, wantReason: "not due"},
+		{name: "Skips an occurrence just beyond the grace period", grace: time.Second, runs: 1, want: 0, wantReason: "not due"},
+		{name: "Creates an occurrence within the grace period", grace: 2 * time.Minute, runs: 1, want: 1},
+		{name: "Creates an occurrence within the grace period once", grace: 2 * time.Minute, runs: 2, want: 1, wantReason: "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			descriptions = nil
+			gracePeriod = tt.grace
+			summary := newRunSummary()
+
+			// Keep the next occurrence more than a second away so it stays
+			// outside the shortest grace period.
+			if wait := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)); wait < 2*time.Second {
+				time.Sleep(wait + 10*time.Millisecond)
+			}
+			lastTime := time.Now()
+
+			for i := 0; i < tt.runs; i++ {
+				err := processTemplate(git, lastTime, filepath.Join(dir, "minutely.md"), newDefaultsLoader(), summary)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(descriptions) != tt.want {
+				t.Errorf("processTemplate() created = %v, want %v", len(descriptions), tt.want)
+			}
+			if tt.wantReason != "" && (len(summary.Skipped) != 1 || summary.Skipped[0].Reason != tt.wantReason) {
+				t.Errorf("processTemplate() skipped = %v, want %v", summary.Skipped, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_firstRun(t *testing.T) {
+	var createdAt []time.Time
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				CreatedAt time.Time `json:"created_at"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			createdAt = append(createdAt, body.CreatedAt)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"yearly.md": `---
+title: Yearly
+crontab: "@yearly"
+---
+`,
+	})
+
+	defer func(id string, mode string, backfill bool) {
+		ciProjectID, firstRun, catchUp = id, mode, backfill
+	}(ciProjectID, firstRun, catchUp)
+	ciProjectID = "1"
+
+	// The next @yearly occurrence after now
+	nextYear := time.Date(time.Now().UTC().Year()+1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		firstRun   string
+		catchUp    bool
+		want       []time.Time
+		wantReason string
+	}{
+		{name: "Schedules from now on the first run", firstRun: "schedule", wantReason: "not due"},
+		{name: "Skips templates on the first run", firstRun: "skip", wantReason: "first run"},
+		{name: "Creates the next occurrence on the first run", firstRun: "create", want: []time.Time{nextYear}},
+		{name: "Creates only the next occurrence on the first run with CATCH_UP", firstRun: "create", catchUp: true, want: []time.Time{nextYear}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt = nil
+			firstRun = tt.firstRun
+			catchUp = tt.catchUp
+			summary := newRunSummary()
+
+			err := processTemplate(git, time.Unix(0, 0), filepath.Join(dir, "yearly.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(createdAt) != len(tt.want) {
+				t.Fatalf("processTemplate() created = %v, want %v", createdAt, tt.want)
+			}
+			for i := range createdAt {
+				if !createdAt[i].Equal(tt.want[i]) {
+					t.Errorf("processTemplate() created_at = %v, want %v", createdAt[i], tt.want[i])
+				}
+			}
+			if tt.wantReason != "" && (len(summary.Skipped) != 1 || summary.Skipped[0].Reason != tt.wantReason) {
+				t.Errorf("processTemplate() skipped = %v, want %v", summary.Skipped, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_oneShot(t *testing.T) {
+	var existing int
+	created := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			created++
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		if r.URL.Query().Get("labels") != "" {
+			w.Header().Set("X-Total", strconv.Itoa(existing))
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"oneshot.md": `---
+title: One-shot
+---
+`,
+	})
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name       string
+		existing   int
+		want       int
+		wantReason string
+	}{
+		{name: "Creates the issue once", existing: 0, want: 1},
+		{name: "Skips once the issue exists", existing: 1, want: 0, wantReason: "already created"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = 0
+			existing = tt.existing
+			summary := newRunSummary()
+
+			err := processTemplate(git, time.Now(), filepath.Join(dir, "oneshot.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != tt.want {
+				t.Errorf("processTemplate() created = %v, want %v", created, tt.want)
+			}
+			if tt.wantReason != "" && (len(summary.Skipped) != 1 || summary.Skipped[0].Reason != tt.wantReason) {
+				t.Errorf("processTemplate() skipped = %v, want %v", summary.Skipped, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_userResolver_resolve(t *testing.T) {
+	lookups := map[string]int{}
+
+	resolver := &userResolver{
+		lookup: func(username string) (int, error) {
+			lookups[username]++
+			switch username {
+			case "assignee1":
+				return 1, nil
+			case "broken":
+				return 0, errors.New("server error")
+			}
+			return 0, errUserNotFound
+		},
+		cache: make(map[string]int),
+	}
+
+	for i := 0; i < 2; i++ {
+		if id, err := resolver.resolve("assignee1"); err != nil || id != 1 {
+			t.Errorf("resolve(assignee1) = %v, %v, want 1, nil", id, err)
+		}
+		if _, err := resolver.resolve("unknown"); !errors.Is(err, errUserNotFound) {
+			t.Errorf("resolve(unknown) error = %v, want %v", err, errUserNotFound)
+		}
+		if _, err := resolver.resolve("broken"); err == nil {
+			t.Errorf("resolve(broken) error = nil, want error")
+		}
+	}
+
+	want := map[string]int{"assignee1": 1, "unknown": 1, "broken": 2}
+	if !reflect.DeepEqual(lookups, want) {
+		t.Errorf("resolve() lookups = %v, want %v", lookups, want)
+	}
+}
+
+func Test_newUserResolver(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		maxRetries, retryDelay = retries, delay
+	}(maxRetries, retryDelay)
+	maxRetries, retryDelay = 3, time.Millisecond
+
+	attempts := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"message":"502 Bad Gateway"}`)
+			return
+		}
+		if r.URL.Query().Get("username") == "assignee1" {
+			fmt.Fprint(w, `[{"id":1,"username":"assignee1"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	id, err := git.users.resolve("assignee1")
+	if err != nil || id != 1 {
+		t.Errorf("resolve(assignee1) = %v, %v, want 1, nil", id, err)
+	}
+	if attempts != 2 {
+		t.Errorf("resolve(assignee1) attempts = %v, want a retry after the transient failure", attempts)
+	}
+
+	if _, err := git.users.resolve("unknown"); !errors.Is(err, errUserNotFound) {
+		t.Errorf("resolve(unknown) error = %v, want %v", err, errUserNotFound)
+	}
+}
+
+func Test_projectCache_get(t *testing.T) {
+	lookups := map[string]int{}
+
+	cache := &projectCache{
+		lookup: func(id string) (*gitlab.Project, *gitlab.Response, error) {
+			lookups[id]++
+			switch id {
+			case "1":
+				return &gitlab.Project{ID: 1}, nil, nil
+			case "group/other":
+				return &gitlab.Project{ID: 2}, nil, nil
+			}
+			return nil, nil, errors.New("server error")
+		},
+		projects: make(map[string]*gitlab.Project),
+	}
+
+	for i := 0; i < 2; i++ {
+		if project, _, err := cache.get("1"); err != nil || project.ID != 1 {
+			t.Errorf("get(1) = %v, %v, want project 1", project, err)
+		}
+		if project, _, err := cache.get("group/other"); err != nil || project.ID != 2 {
+			t.Errorf("get(group/other) = %v, %v, want project 2", project, err)
+		}
+		if _, _, err := cache.get("broken"); err == nil {
+			t.Errorf("get(broken) error = nil, want error")
+		}
+	}
+
+	want := map[string]int{"1": 1, "group/other": 1, "broken": 2}
+	if !reflect.DeepEqual(lookups, want) {
+		t.Errorf("get() lookups = %v, want %v", lookups, want)
+	}
+}
+
+func Test_createIssue_project(t *testing.T) {
+	var created []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/group/other", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":5}`)
+	})
+	mux.HandleFunc("/api/v4/projects/group/triage", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":6}`)
+	})
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects/nogroup/triage" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"404 Project Not Found"}`)
+			return
+		}
+		if r.Method == http.MethodPost {
+			created = append(created, r.URL.Path)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name    string
+		project string
+		group   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Defaults to CI_PROJECT_ID", project: "", want: "/api/v4/projects/1/issues"},
+		{name: "Uses template project path", project: "group/other", want: "/api/v4/projects/5/issues"},
+		{name: "Uses the triage project of the template group", group: "group", want: "/api/v4/projects/6/issues"},
+		{name: "Prefers template project over group", project: "group/other", group: "group", want: "/api/v4/projects/5/issues"},
+		{name: "Fails when the group has no triage project", group: "nogroup", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = nil
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", Project: tt.project, Group: tt.group})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(created, []string{tt.want}) {
+				t.Errorf("createIssue() created = %v, want %v", created, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withRetry(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		maxRetries, retryDelay = retries, delay
+	}(maxRetries, retryDelay)
+	maxRetries, retryDelay = 3, time.Millisecond
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "Succeeds first time", statuses: []int{200}, wantAttempts: 1},
+		{name: "Retries server errors", statuses: []int{502, 503, 200}, wantAttempts: 3},
+		{name: "Gives up after max attempts", statuses: []int{502, 502, 502, 200}, wantAttempts: 3, wantErr: true},
+		{name: "Fails fast on client errors", statuses: []int{404, 200}, wantAttempts: 1, wantErr: true},
+		{name: "Retries rate limited requests", statuses: []int{429, 200}, retryAfter: "0", wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+				fmt.Fprint(w, `{"id":1}`)
+			})
+			git := newTestClient(t, mux)
+
+			err := withRetry(func() (*gitlab.Response, error) {
+				_, resp, err := git.Projects.GetProject(1, nil)
+				return resp, err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("withRetry() attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "Parses seconds", status: 429, header: "3", want: 3 * time.Second, wantOK: true},
+		{name: "Ignores missing header", status: 429, header: "", wantOK: false},
+		{name: "Ignores other statuses", status: 503, header: "3", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &gitlab.Response{Response: &http.Response{StatusCode: tt.status, Header: http.Header{}}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+
+			got, ok := retryAfter(resp)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_newHTTPClient_rateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	defer func(limit int) { rateLimit = limit }(rateLimit)
+	rateLimit = 20
+
+	httpClient := newHTTPClient()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("newHTTPClient() made 3 requests in %v, want at least 100ms at 20 requests per second", elapsed)
+	}
+}
+
+func Test_getLastRunTime_paginates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/pipelines", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":10}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id":20}]`)
+		default:
+			t.Errorf("unexpected page %v", r.URL.Query().Get("page"))
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/10/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":100,"name":"other job","finished_at":"2020-01-01T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/20/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":200,"name":"recurring issues","finished_at":"2020-01-02T00:00:00Z"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string, name string) { ciProjectID, ciJobName = id, name }(ciProjectID, ciJobName)
+	ciProjectID, ciJobName = "1", "recurring issues"
+
+	got, err := getLastRunTime(git)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("getLastRunTime() = %v, want %v", got, want)
+	}
+}
+
+func Test_getLastRunTime_ref(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/pipelines", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("ref") {
+		case "main":
+			fmt.Fprint(w, `[{"id":10,"ref":"main"}]`)
+		case "":
+			fmt.Fprint(w, `[{"id":20,"ref":"feature"},{"id":10,"ref":"main"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/10/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":100,"name":"recurring issues","finished_at":"2020-01-01T00:00:00Z"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/20/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":200,"name":"recurring issues","finished_at":"2020-01-02T00:00:00Z"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id, name, ref string) { ciProjectID, ciJobName, pipelineRef = id, name, ref }(ciProjectID, ciJobName, pipelineRef)
+	ciProjectID, ciJobName = "1", "recurring issues"
+
+	tests := []struct {
+		name string
+		ref  string
+		want time.Time
+	}{
+		{name: "Ignores pipelines on other refs", ref: "main", want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Uses pipelines on any ref without a filter", ref: "", want: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "Has no last run without pipelines on the ref", ref: "release", want: time.Unix(0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipelineRef = tt.ref
+
+			got, err := getLastRunTime(git)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("getLastRunTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getLastRunTime_skipsUnfinishedJobs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/pipelines", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":10},{"id":20}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/10/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":100,"name":"recurring issues","finished_at":null}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/pipelines/20/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":200,"name":"recurring issues","finished_at":"2020-01-02T00:00:00Z"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string, name string) { ciProjectID, ciJobName = id, name }(ciProjectID, ciJobName)
+	ciProjectID, ciJobName = "1", "recurring issues"
+
+	got, err := getLastRunTime(git)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("getLastRunTime() = %v, want %v", got, want)
+	}
+}
+
+func Test_buildIssueOptions_confidential(t *testing.T) {
+	git := newTestClient(t, http.NewServeMux())
+
+	defer func(confidential bool) { defaultConfidential = confidential }(defaultConfidential)
+
+	tests := []struct {
+		name                string
+		defaultConfidential bool
+		confidential        *bool
+		want                bool
+	}{
+		{name: "Defaults to not confidential", want: false},
+		{name: "Uses DEFAULT_CONFIDENTIAL when unset", defaultConfidential: true, want: true},
+		{name: "Explicit false overrides DEFAULT_CONFIDENTIAL", defaultConfidential: true, confidential: gitlab.Bool(false), want: false},
+		{name: "Explicit true is kept", confidential: gitlab.Bool(true), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultConfidential = tt.defaultConfidential
+
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{Confidential: tt.confidential})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *options.Confidential != tt.want {
+				t.Errorf("buildIssueOptions() Confidential = %v, want %v", *options.Confidential, tt.want)
+			}
+		})
+	}
+}
+
+func Test_boolValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    *bool
+		fallback bool
+		want     bool
+	}{
+		{name: "Unset uses fallback true", value: nil, fallback: true, want: true},
+		{name: "Unset uses fallback false", value: nil, fallback: false, want: false},
+		{name: "Explicit false wins", value: gitlab.Bool(false), fallback: true, want: false},
+		{name: "Explicit true wins", value: gitlab.Bool(true), fallback: false, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := boolValue(tt.value, tt.fallback); got != tt.want {
+				t.Errorf("boolValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildIssueOptions_issueType(t *testing.T) {
+	git := newTestClient(t, http.NewServeMux())
+
+	tests := []struct {
+		name      string
+		issueType string
+		want      string
+		wantErr   bool
+	}{
+		{name: "Defaults to issue", issueType: "", want: `"issue_type":"issue"`},
+		{name: "Sets incident", issueType: "incident", want: `"issue_type":"incident"`},
+		{name: "Sets task", issueType: "task", want: `"issue_type":"task"`},
+		{name: "Rejects unknown type", issueType: "epic", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := buildIssueOptions(git, &gitlab.Project{ID: 1}, &metadata{Title: "Test Title", IssueType: tt.issueType})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildIssueOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			body, err := json.Marshal(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tt.want) || !strings.Contains(string(body), `"title":"Test Title"`) {
+				t.Errorf("buildIssueOptions() body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_estimate(t *testing.T) {
+	var estimates []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			fmt.Fprint(w, `{"id":1,"iid":7}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/7/time_estimate", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		estimates = append(estimates, body.Duration)
+		fmt.Fprint(w, `{}`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name     string
+		estimate string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "Skips estimate when unset", estimate: "", want: nil},
+		{name: "Sets estimate in seconds", estimate: "4h", want: []string{"14400s"}},
+		{name: "Rejects invalid estimate", estimate: "four hours", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimates = nil
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", Estimate: tt.estimate})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(estimates, tt.want) {
+				t.Errorf("createIssue() estimates = %v, want %v", estimates, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadDescriptionFile(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"weekly/report.md":     "",
+		"shared/checklist.txt": "Shared description",
+	})
+
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = dir
+
+	tests := []struct {
+		name            string
+		descriptionFile string
+		want            string
+		wantErr         bool
+	}{
+		{name: "Keeps inline description when unset", descriptionFile: "", want: "Inline description"},
+		{name: "Loads file relative to template", descriptionFile: "../shared/checklist.txt", want: "Shared description"},
+		{name: "Errors on missing file", descriptionFile: "missing.md", wantErr: true},
+		{name: "Rejects path traversal", descriptionFile: "../../outside.md", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &metadata{Description: "Inline description", DescriptionFile: tt.descriptionFile}
+
+			err := loadDescriptionFile(data, filepath.Join(dir, "weekly", "report.md"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadDescriptionFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && data.Description != tt.want {
+				t.Errorf("loadDescriptionFile() Description = %v, want %v", data.Description, tt.want)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_disabled(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+	})
+	git := newTestClient(t, mux)
+
+	dir := writeTemplates(t, map[string]string{
+		"disabled.md": `---
+title: Disabled
+crontab: "@daily"
+enabled: false
+---
+`,
+	})
+
+	summary := newRunSummary()
+
+	err := processTemplate(git, time.Unix(0, 0), filepath.Join(dir, "disabled.md"), newDefaultsLoader(), summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summary.Created) != 0 || len(summary.Skipped) != 1 || summary.Skipped[0].Reason != "disabled" {
+		t.Errorf("processTemplate() created = %v, skipped = %v, want one disabled skip", summary.Created, summary.Skipped)
+	}
+}
+
+func Test_processTemplate_strict(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+
+	dir := writeTemplates(t, map[string]string{
+		"oneshot.md": `---
+title: One-shot
+---
+`,
+	})
+
+	defer func(id string, url string, enabled bool) {
+		ciProjectID, notifyWebhookURL, strict = id, url, enabled
+	}(ciProjectID, notifyWebhookURL, strict)
+	ciProjectID = "1"
+	notifyWebhookURL = webhook.URL
+
+	tests := []struct {
+		name       string
+		strict     bool
+		wantErrors int
+	}{
+		{name: "Only logs warnings by default", strict: false, wantErrors: 0},
+		{name: "Fails the template on warnings when strict", strict: true, wantErrors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strict = tt.strict
+			summary := newRunSummary()
+
+			err := processTemplate(git, time.Now(), filepath.Join(dir, "oneshot.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(summary.Created) != 1 {
+				t.Errorf("processTemplate() created = %v, want the issue listed", summary.Created)
+			}
+			if len(summary.Errors) != tt.wantErrors {
+				t.Errorf("processTemplate() errors = %v, want %v", summary.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func Test_unknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+	}{
+		{
+			name: "Finds unknown YAML keys",
+			contents: `---
+title: Test
+assignee: ["user1"]
+labls: ["chore"]
+---
+Body
+`,
+			want: []string{"assignee", "labls"},
+		},
+		{
+			name: "Accepts known YAML keys",
+			contents: `---
+title: Test
+assignees: ["user1"]
+---
+`,
+			want: nil,
+		},
+		{
+			name: "Finds unknown TOML keys",
+			contents: `+++
+title = "Test"
+crontabs = "@daily"
++++
+`,
+			want: []string{"crontabs"},
+		},
+		{
+			name:     "Finds unknown JSON keys",
+			contents: `{"title": "Test", "timezon": "UTC"}`,
+			want:     []string{"timezon"},
+		},
+		{
+			name:     "Rejects internal fields",
+			contents: "---\nnexttime: 2020-01-01T00:00:00Z\n---\n",
+			want:     []string{"nexttime"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unknownKeys([]byte(tt.contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unknownKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadTemplate_unknownKeys(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"typo.md": `---
+title: Typo
+assignee: ["user1"]
+---
+`,
+	})
+
+	defer func(enabled bool) { strict = enabled }(strict)
+
+	tests := []struct {
+		name    string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "Warns about unknown keys by default", strict: false},
+		{name: "Rejects unknown keys when strict", strict: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strict = tt.strict
+
+			_, err := loadTemplate(filepath.Join(dir, "typo.md"), newDefaultsLoader())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parseMetadata_formats(t *testing.T) {
+	want := &metadata{
+		Title:       "Test Title",
+		Description: "Test Description",
+		Labels:      []string{"label1", "label2"},
+		Weight:      gitlab.Int(3),
+		Crontab:     crontabs{"@daily"},
+	}
+
+	tests := []struct {
+		name     string
+		contents []byte
+	}{
+		{
+			name: "Parses YAML front matter",
+			contents: ([]byte)(`---
+title: Test Title
+labels: [ "label1", "label2" ]
+weight: 3
+crontab: "@daily"
+---
+Test Description`),
+		},
+		{
+			name: "Parses TOML front matter",
+			contents: ([]byte)(`+++
+title = "Test Title"
+labels = [ "label1", "label2" ]
+weight = 3
+crontab = "@daily"
++++
+Test Description`),
+		},
+		{
+			name: "Parses JSON front matter",
+			contents: ([]byte)(`{
+  "title": "Test Title",
+  "labels": [ "label1", "label2" ],
+  "weight": 3,
+  "crontab": "@daily"
+}
+Test Description`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetadata(tt.contents)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseMetadata() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_parseMetadata_invalidFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []byte
+	}{
+		{name: "Rejects unterminated TOML", contents: ([]byte)("+++\ntitle = \"Test Title\"\n")},
+		{name: "Rejects invalid TOML", contents: ([]byte)("+++\ntitle = \n+++\n")},
+		{name: "Rejects invalid JSON", contents: ([]byte)(`{ "title": `)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseMetadata(tt.contents); err == nil {
+				t.Errorf("parseMetadata() error = nil, want error")
+			}
+		})
+	}
+}
+
+func Test_resolveEpic(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		maxRetries, retryDelay = retries, delay
+	}(maxRetries, retryDelay)
+	maxRetries, retryDelay = 3, time.Millisecond
+
+	failures := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/groups/2/epics", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":30,"iid":3,"title":"Quarterly planning"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":40,"iid":4,"title":"Quarterly planning 2"}]`)
+	})
+	mux.HandleFunc("/api/v4/groups/7/epics", func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"message":"502 Bad Gateway"}`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":70,"iid":7,"title":"Roadmap"}]`)
+	})
+	mux.HandleFunc("/api/v4/groups/5/epics", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"403 Forbidden"}`)
+	})
+	git := newTestClient(t, mux)
+
+	tests := []struct {
+		name      string
+		namespace *gitlab.ProjectNamespace
+		epic      string
+		failures  int
+		want      int
+		wantErr   string
+	}{
+		{name: "Uses numeric IID", namespace: &gitlab.ProjectNamespace{ID: 2, Kind: "group"}, epic: "12", want: 12},
+		{name: "Resolves title from a later page", namespace: &gitlab.ProjectNamespace{ID: 2, Kind: "group"}, epic: "Quarterly planning 2", want: 4},
+		{name: "Retries a transient failure", namespace: &gitlab.ProjectNamespace{ID: 7, Kind: "group"}, epic: "Roadmap", failures: 1, want: 7},
+		{name: "Errors on unknown title", namespace: &gitlab.ProjectNamespace{ID: 2, Kind: "group"}, epic: "Unknown", wantErr: "not found"},
+		{name: "Explains missing epics", namespace: &gitlab.ProjectNamespace{ID: 5, Kind: "group", FullPath: "free"}, epic: "Unknown", wantErr: "Premium"},
+		{name: "Requires a group", namespace: &gitlab.ProjectNamespace{ID: 6, Kind: "user"}, epic: "12", wantErr: "does not belong to a group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures = tt.failures
+
+			got, err := resolveEpic(git, &gitlab.Project{ID: 1, Namespace: tt.namespace}, tt.epic)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveEpic() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveEpic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveIteration(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/groups/2/iterations", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "opened" || r.URL.Query().Get("include_ancestors") != "true" {
+			t.Errorf("unexpected iteration query %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `[{"id":50,"title":"Sprint 1","start_date":"2020-01-06","due_date":"2020-01-19"},{"id":51,"title":"Sprint 2","start_date":"2020-01-20","due_date":"2020-02-02"}]`)
+	})
+	mux.HandleFunc("/api/v4/groups/5/iterations", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"404 Not Found"}`)
+	})
+	git := newTestClient(t, mux)
+
+	group := &gitlab.ProjectNamespace{ID: 2, Kind: "group"}
+	date := time.Date(2020, 1, 22, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		namespace *gitlab.ProjectNamespace
+		iteration string
+		want      int
+		wantErr   error
+		wantText  string
+	}{
+		{name: "Uses numeric ID", namespace: group, iteration: "12", want: 12},
+		{name: "Resolves title", namespace: group, iteration: "Sprint 1", want: 50},
+		{name: "Finds the iteration covering the occurrence", namespace: group, iteration: "auto", want: 51},
+		{name: "Errors on unknown title", namespace: group, iteration: "Sprint 9", wantText: "not found"},
+		{name: "Reports unavailable iterations", namespace: &gitlab.ProjectNamespace{ID: 5, Kind: "group", FullPath: "free"}, iteration: "auto", wantErr: errNoIterations},
+		{name: "Requires a group", namespace: &gitlab.ProjectNamespace{ID: 6, Kind: "user"}, iteration: "Sprint 1", wantText: "does not belong to a group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveIteration(git, &gitlab.Project{ID: 1, Namespace: tt.namespace}, tt.iteration, date)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveIteration() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantText != "" && (err == nil || !strings.Contains(err.Error(), tt.wantText)) {
+				t.Fatalf("resolveIteration() error = %v, want %v", err, tt.wantText)
+			}
+			if tt.wantErr == nil && tt.wantText == "" && err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveIteration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withIteration(t *testing.T) {
+	if got, want := withIteration("Sprint tasks\n", 51), "Sprint tasks\n\n/iteration *iteration:51"; got != want {
+		t.Errorf("withIteration() = %q, want %q", got, want)
+	}
+	if got, want := withIteration("", 51), "/iteration *iteration:51"; got != want {
+		t.Errorf("withIteration() = %q, want %q", got, want)
+	}
+}
+
+func Test_beforeStartDate(t *testing.T) {
+	nextTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		startDate string
+		timezone  string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "Ignores unset start date", startDate: "", want: false},
+		{name: "Skips occurrences before a future start date", startDate: "2020-02-01", want: true},
+		{name: "Allows occurrences after a past start date", startDate: "2020-01-01", want: false},
+		{name: "Allows occurrences on the start date", startDate: "2020-01-15", want: false},
+		{name: "Uses the template timezone", startDate: "2020-01-15", timezone: "Pacific/Honolulu", want: true},
+		{name: "Rejects invalid dates", startDate: "01/02/2020", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := beforeStartDate(&metadata{NextTime: nextTime, StartDate: tt.startDate, Timezone: tt.timezone})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("beforeStartDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("beforeStartDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_afterEndDate(t *testing.T) {
+	now := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		endDate string
+		want    bool
+		wantErr bool
+	}{
+		{name: "Ignores unset end date", endDate: "", want: false},
+		{name: "Allows runs before the end date", endDate: "2020-02-01", want: false},
+		{name: "Allows runs on the end date", endDate: "2020-01-15", want: false},
+		{name: "Expires after the end date", endDate: "2020-01-14", want: true},
+		{name: "Rejects invalid dates", endDate: "2020-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := afterEndDate(&metadata{EndDate: tt.endDate}, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("afterEndDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("afterEndDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_maxOccurrences(t *testing.T) {
+	var created []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, `{"message":"Label already exists"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Labels string `json:"labels"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			created = append(created, body.Labels)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		if r.URL.Query().Get("labels") == "recurring::weekly/report" {
+			w.Header().Set("X-Total", "3")
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name           string
+		maxOccurrences int
+		want           []string
+		wantErr        error
+	}{
+		{name: "Creates issues below the cap", maxOccurrences: 4, want: []string{"label1,recurring::weekly/report"}},
+		{name: "Skips issues at the cap", maxOccurrences: 3, wantErr: errMaxOccurrences},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = nil
+
+			data := &metadata{Title: "Test Title", Labels: []string{"label1"}, MaxOccurrences: tt.maxOccurrences, Template: "weekly/report"}
+
+			_, err := createIssue(git, data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("createIssue() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(created, tt.want) {
+				t.Errorf("createIssue() created = %v, want %v", created, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_retry(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		maxRetries, retryDelay = retries, delay
+	}(maxRetries, retryDelay)
+	maxRetries, retryDelay = 3, time.Millisecond
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name      string
+		stored    bool
+		wantPosts int
+		wantErr   error
+	}{
+		{name: "Posts the issue again when the failed create was not stored", stored: false, wantPosts: 2},
+		{name: "Stops when the failed create was stored", stored: true, wantPosts: 1, wantErr: errDuplicateIssue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int
+			var stored string
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"id":1}`)
+			})
+			mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"id":1}`)
+			})
+			mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					posts++
+					if posts == 1 {
+						if tt.stored {
+							var body struct {
+								Description string `json:"description"`
+							}
+							if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+								t.Fatal(err)
+							}
+							stored = body.Description
+						}
+						w.WriteHeader(http.StatusBadGateway)
+						fmt.Fprint(w, `{"message":"502 Bad Gateway"}`)
+						return
+					}
+					fmt.Fprint(w, `{"id":1,"iid":1}`)
+					return
+				}
+				if stored != "" && r.URL.Query().Get("in") == "description" {
+					json.NewEncoder(w).Encode([]map[string]interface{}{{"iid": 1, "description": stored}})
+					return
+				}
+				fmt.Fprint(w, `[]`)
+			})
+			git := newTestClient(t, mux)
+
+			data := &metadata{Title: "Test Title", Template: "daily", Warnings: &warningLog{}}
+
+			_, err := createIssue(git, data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("createIssue() error = %v, want %v", err, tt.wantErr)
+			}
+			if posts != tt.wantPosts {
+				t.Errorf("createIssue() posts = %v, want %v", posts, tt.wantPosts)
+			}
+		})
+	}
+}
+
+func Test_templateName(t *testing.T) {
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = "/builds/project/.gitlab/recurring_issue_templates"
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "Strips extension", path: "/builds/project/.gitlab/recurring_issue_templates/daily.md", want: "daily"},
+		{name: "Keeps subdirectories", path: "/builds/project/.gitlab/recurring_issue_templates/weekly/report.md", want: "weekly/report"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templateName(tt.path); got != tt.want {
+				t.Errorf("templateName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_templateLabel(t *testing.T) {
+	var createdLabels, issueLabels []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		createdLabels = append(createdLabels, body.Name)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Labels string `json:"labels"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			issueLabels = append(issueLabels, body.Labels)
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	_, err := createIssue(git, &metadata{Title: "Test Title", Template: "daily"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"recurring::daily"}; !reflect.DeepEqual(createdLabels, want) {
+		t.Errorf("createIssue() created labels = %v, want %v", createdLabels, want)
+	}
+	if want := []string{"recurring::daily"}; !reflect.DeepEqual(issueLabels, want) {
+		t.Errorf("createIssue() issue labels = %v, want %v", issueLabels, want)
+	}
+}
+
+func Test_rollForwardWeekend(t *testing.T) {
+	tests := []struct {
+		name string
+		date time.Time
+		want time.Time
+	}{
+		{name: "Rolls Saturday to Monday", date: time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{name: "Rolls Sunday to Monday", date: time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{name: "Leaves weekdays unchanged", date: time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollForwardWeekend(tt.date); !got.Equal(tt.want) {
+				t.Errorf("rollForwardWeekend() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_rollWeekendDue(t *testing.T) {
+	var dueDate string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				DueDate string `json:"due_date"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			dueDate = body.DueDate
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	defer func(roll bool) { rollWeekendDue = roll }(rollWeekendDue)
+
+	tests := []struct {
+		name string
+		roll bool
+		want string
+	}{
+		{name: "Rolls a Saturday due date to Monday when enabled", roll: true, want: "2020-01-20"},
+		{name: "Keeps a Saturday due date when disabled", roll: false, want: "2020-01-18"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollWeekendDue = tt.roll
+			dueDate = ""
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", DueDate: "2020-01-18"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dueDate != tt.want {
+				t.Errorf("createIssue() due date = %v, want %v", dueDate, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_dryRun(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("createIssue() made a %v request in a dry run", r.Method)
+		}
+		if r.URL.Query().Get("in") == "title" && r.URL.Query().Get("search") == "Existing" {
+			fmt.Fprint(w, `[{"iid":1,"title":"Existing"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string, dry bool) { ciProjectID, dryRun = id, dry }(ciProjectID, dryRun)
+	ciProjectID = "1"
+	dryRun = true
+
+	tests := []struct {
+		name    string
+		title   string
+		wantErr error
+		want    string
+	}{
+		{name: "Reports an issue that would be created", title: "New", want: "Dry run - WOULD CREATE: weekly - New"},
+		{name: "Reports an open duplicate that would be skipped", title: "Existing", wantErr: errDuplicateIssue, want: "Dry run - WOULD SKIP (duplicate): weekly - Existing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			log.SetOutput(&buffer)
+			defer log.SetOutput(os.Stderr)
+
+			_, err := createIssue(git, &metadata{Title: tt.title, Template: "weekly"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("createIssue() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(buffer.String(), tt.want) {
+				t.Errorf("createIssue() logged %q, want %q", buffer.String(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_createMissingLabels(t *testing.T) {
+	var created []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Name  string `json:"name"`
+				Color string `json:"color"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			created = append(created, body.Name+" "+body.Color)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":1}`)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"id":2,"name":"label2"}]`)
+			return
+		}
+		w.Header().Set("X-Next-Page", "2")
+		fmt.Fprint(w, `[{"id":1,"name":"label1"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(color string) { labelColor = color }(labelColor)
+	labelColor = "#ff0000"
+
+	err := createMissingLabels(git, 1, []string{"label1", "label2", "label3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"label3 #ff0000"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("createMissingLabels() created = %v, want %v", created, want)
+	}
+}
+
+func Test_findMilestoneForDate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/milestones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "active" {
+			t.Errorf("unexpected milestone state %v", r.URL.Query().Get("state"))
+		}
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":10,"title":"Undated"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":11,"title":"January","start_date":"2020-01-01","due_date":"2020-01-31"}]`)
+	})
+	mux.HandleFunc("/api/v4/groups/2/milestones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id":19,"title":"December","start_date":"2019-12-01","due_date":"2019-12-31"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"id":20,"title":"February","start_date":"2020-02-01","due_date":"2020-02-29"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	project := &gitlab.Project{ID: 1, Namespace: &gitlab.ProjectNamespace{ID: 2, Kind: "group"}}
+
+	tests := []struct {
+		name string
+		date time.Time
+		want int
+	}{
+		{name: "Picks project milestone covering the date from a later page", date: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC), want: 11},
+		{name: "Includes the due date", date: time.Date(2020, 1, 31, 23, 0, 0, 0, time.UTC), want: 11},
+		{name: "Falls back to group milestones from a later page", date: time.Date(2020, 2, 29, 9, 0, 0, 0, time.UTC), want: 20},
+		{name: "Returns nothing when no milestone covers the date", date: time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findMilestoneForDate(git, project, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("findMilestoneForDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveTemplatesDir(t *testing.T) {
+	projectDir := writeTemplates(t, map[string]string{"templates/daily.md": ""})
+
+	tests := []struct {
+		name    string
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{name: "Joins relative directory with the project directory", dir: "templates", want: filepath.Join(projectDir, "templates")},
+		{name: "Uses absolute directory as-is", dir: filepath.Join(projectDir, "templates"), want: filepath.Join(projectDir, "templates")},
+		{name: "Rejects missing directory", dir: "missing", wantErr: true},
+		{name: "Rejects file", dir: "templates/daily.md", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTemplatesDir(projectDir, tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveTemplatesDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveTemplatesDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findTemplates_walkError(t *testing.T) {
+	var paths []string
+	summary := newRunSummary()
+
+	err := findTemplates(&paths, summary)("unreadable", nil, errors.New("permission denied"))
+	if err != nil {
+		t.Errorf("findTemplates() error = %v, want nil", err)
+	}
+
+	if len(summary.Errors) != 1 || summary.Errors[0].Path != "unreadable" || len(paths) != 0 {
+		t.Errorf("findTemplates() errors = %v, paths = %v, want the walk error", summary.Errors, paths)
+	}
+}
+
+func Test_processTemplates_concurrency(t *testing.T) {
+	templates := map[string]string{}
+	for i := 0; i < 20; i++ {
+		templates[fmt.Sprintf("template%02d.md", i)] = `---
+title: Template
+crontab: "not a crontab"
+---
+`
+	}
+	dir := writeTemplates(t, templates)
+
+	defer func(workers int) { concurrency = workers }(concurrency)
+	concurrency = 4
+
+	state := &runState{LastRun: time.Now(), Templates: map[string]time.Time{}, updated: map[string]time.Time{}}
+	summary := newRunSummary()
+
+	err := processTemplates(nil, dir, state, summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.TemplatesScanned != 20 || len(summary.Errors) != 20 {
+		t.Fatalf("processTemplates() scanned = %v, errors = %v, want 20 of each", summary.TemplatesScanned, len(summary.Errors))
+	}
+	for i, failure := range summary.Errors {
+		if want := fmt.Sprintf("template%02d.md", i); filepath.Base(failure.Path) != want {
+			t.Errorf("processTemplates() error %d = %v, want %v", i, failure.Path, want)
+		}
+	}
+	if len(state.updated) != 0 {
+		t.Errorf("processTemplates() recorded runs = %v, want none for failed templates", state.updated)
+	}
+}
+
+func Test_processTemplates_defaults(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"weekly/_defaults.yaml": `crontab: "@weekly"
+labels: ["weekly"]
+timezone: "Not/AZone"
+`,
+		"weekly/inherits.md": `---
+title: Inherits
+---
+`,
+		"weekly/overrides.md": `---
+title: Overrides
+timezone: "UTC"
+---
+`,
+		"monthly/missing.md": `---
+title: Missing
+crontab: "@monthly"
+---
+`,
+	})
+
+	summary := newRunSummary()
+
+	err := processTemplates(nil, dir, newRunState(time.Now()), summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.TemplatesScanned != 3 {
+		t.Errorf("processTemplates() scanned = %v, want 3", summary.TemplatesScanned)
+	}
+	if len(summary.Errors) != 1 {
+		t.Fatalf("processTemplates() errors = %v, want 1", summary.Errors)
+	}
+	if filepath.Base(summary.Errors[0].Path) != "inherits.md" || !strings.Contains(summary.Errors[0].Error, "Not/AZone") {
+		t.Errorf("processTemplates() error = %v, want inherited timezone error", summary.Errors[0])
+	}
+	if len(summary.Skipped) != 2 || filepath.Base(summary.Skipped[0].Path) != "missing.md" || filepath.Base(summary.Skipped[1].Path) != "overrides.md" {
+		t.Errorf("processTemplates() skipped = %v, want missing.md and overrides.md", summary.Skipped)
+	}
+}
+
+func Test_mergeDefaults(t *testing.T) {
+	data := &metadata{Title: "Template", Labels: []string{"template"}}
+	defaults := &metadata{Title: "Default", Labels: []string{"default"}, Assignees: []string{"user"}, Crontab: crontabs{"@daily"}}
+
+	mergeDefaults(data, defaults)
+
+	want := &metadata{Title: "Template", Labels: []string{"template"}, Assignees: []string{"user"}, Crontab: crontabs{"@daily"}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("mergeDefaults() = %+v, want %+v", data, want)
+	}
+}
+
+func Test_mergeDefaults_falseOverridesDefault(t *testing.T) {
+	data := &metadata{AppendDate: gitlab.Bool(false), CarryOver: gitlab.Bool(false), DueTime: gitlab.Bool(false)}
+	defaults := &metadata{AppendDate: gitlab.Bool(true), CarryOver: gitlab.Bool(true), DueTime: gitlab.Bool(true)}
+
+	mergeDefaults(data, defaults)
+
+	want := &metadata{AppendDate: gitlab.Bool(false), CarryOver: gitlab.Bool(false), DueTime: gitlab.Bool(false)}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("mergeDefaults() = %+v, want %+v", data, want)
+	}
+}
+
+func Test_withFooter(t *testing.T) {
+	nextTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{
+			name: "Uses footer as empty description",
+			want: "Created by gitlab-recurring-issues from `weekly/report` on `2020-01-15`",
+		},
+		{
+			name:        "Appends footer after a separator",
+			description: "Do the things\n",
+			want:        "Do the things\n\n---\n\nCreated by gitlab-recurring-issues from `weekly/report` on `2020-01-15`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withFooter(&metadata{Template: "weekly/report", Description: tt.description, NextTime: nextTime})
+			if got != tt.want {
+				t.Errorf("withFooter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_author(t *testing.T) {
+	var sudo string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			sudo = r.Header.Get("Sudo")
+			if sudo == "unprivileged" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"message":"403 Forbidden - Must be admin to use sudo"}`)
+				return
+			}
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name     string
+		author   string
+		wantSudo string
+		wantErr  bool
+	}{
+		{name: "Creates issue as the token user by default", author: "", wantSudo: ""},
+		{name: "Creates issue as the author", author: "service-account", wantSudo: "service-account"},
+		{name: "Fails without sudo rights", author: "unprivileged", wantSudo: "unprivileged", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sudo = ""
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", Author: tt.author})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "sudo") {
+				t.Errorf("createIssue() error = %v, want mention of sudo", err)
+			}
+			if sudo != tt.wantSudo {
+				t.Errorf("createIssue() Sudo = %v, want %v", sudo, tt.wantSudo)
+			}
+		})
+	}
+}
+
+func Test_exitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary *runSummary
+		want    int
+	}{
+		{name: "Succeeds when nothing is due", summary: newRunSummary(), want: exitOK},
+		{name: "Succeeds when issues are created", summary: &runSummary{Created: []summaryEntry{{Path: "daily.md"}}}, want: exitOK},
+		{name: "Fails when a template fails", summary: &runSummary{Created: []summaryEntry{{Path: "daily.md"}}, Errors: []summaryEntry{{Path: "weekly.md"}}}, want: exitTemplatesFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.summary); got != tt.want {
+				t.Errorf("exitCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_healthStatus(t *testing.T) {
+	var healthStatus string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			fmt.Fprint(w, `{"id":1,"iid":7}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/7", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			HealthStatus string `json:"health_status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		healthStatus = body.HealthStatus
+		fmt.Fprint(w, `{"id":1,"iid":7}`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name         string
+		healthStatus string
+		want         string
+		wantErr      bool
+	}{
+		{name: "Leaves health status unset", healthStatus: "", want: ""},
+		{name: "Sets health status after creation", healthStatus: "needs_attention", want: "needs_attention"},
+		{name: "Rejects unknown health status", healthStatus: "fine", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthStatus = ""
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", HealthStatus: tt.healthStatus})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if healthStatus != tt.want {
+				t.Errorf("createIssue() health status = %v, want %v", healthStatus, tt.want)
+			}
+		})
+	}
+}
+
+func Test_linkPreviousIssue(t *testing.T) {
+	var previous string
+	var linked []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("labels") != "recurring::weekly" || r.URL.Query().Get("order_by") != "created_at" || r.URL.Query().Get("sort") != "desc" {
+			t.Errorf("unexpected issue query %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, previous)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/5/links", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TargetIssueIID string `json:"target_issue_iid"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		linked = append(linked, body.TargetIssueIID)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	git := newTestClient(t, mux)
+
+	tests := []struct {
+		name     string
+		previous string
+		want     []string
+	}{
+		{name: "Links the most recent previous occurrence", previous: `[{"iid":5},{"iid":4}]`, want: []string{"4"}},
+		{name: "Skips when there is no previous occurrence", previous: `[{"iid":5}]`, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous = tt.previous
+			linked = nil
+
+			err := linkPreviousIssue(git, 1, &metadata{Template: "weekly"}, &gitlab.Issue{IID: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(linked, tt.want) {
+				t.Errorf("linkPreviousIssue() linked = %v, want %v", linked, tt.want)
+			}
+		})
+	}
+}
+
+func Test_linkBlockingIssue(t *testing.T) {
+	var linked []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/issues/12", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":112,"iid":12}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/99", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"404 Not found"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/5/links", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TargetIssueIID string `json:"target_issue_iid"`
+			LinkType       string `json:"link_type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		linked = append(linked, body.LinkType+" "+body.TargetIssueIID)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	git := newTestClient(t, mux)
+
+	tests := []struct {
+		name      string
+		targetIID int
+		linkType  string
+		want      []string
+		wantErr   string
+	}{
+		{name: "Links a blocked issue", targetIID: 12, linkType: "blocks", want: []string{"blocks 12"}},
+		{name: "Links a blocking issue", targetIID: 12, linkType: "is_blocked_by", want: []string{"is_blocked_by 12"}},
+		{name: "Reports a missing issue", targetIID: 99, linkType: "blocks", wantErr: "issue #99 not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linked = nil
+
+			err := linkBlockingIssue(git, 1, &gitlab.Issue{IID: 5}, tt.targetIID, tt.linkType)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("linkBlockingIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("linkBlockingIssue() error = %v, want mention of %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(linked, tt.want) {
+				t.Errorf("linkBlockingIssue() linked = %v, want %v", linked, tt.want)
+			}
+		})
+	}
+}
+
+func Test_closePreviousIssue(t *testing.T) {
+	var previous string
+	var closed []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("labels") != "recurring::weekly" || r.URL.Query().Get("state") != "opened" {
+			t.Errorf("unexpected issue query %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, previous)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method %v", r.Method)
+		}
+		var body struct {
+			StateEvent string `json:"state_event"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.StateEvent != "close" {
+			t.Errorf("unexpected state_event %v", body.StateEvent)
+		}
+		closed = append(closed, strings.TrimPrefix(r.URL.Path, "/api/v4/projects/1/issues/"))
+		fmt.Fprint(w, `{}`)
+	})
+	git := newTestClient(t, mux)
+
+	created := time.Date(2020, 1, 13, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		previous string
+		want     []string
+	}{
+		{
+			name:     "Closes the most recent previous occurrence",
+			previous: `[{"iid":5,"state":"opened","labels":["recurring::weekly"]},{"iid":4,"state":"opened","labels":["recurring::weekly"]}]`,
+			want:     []string{"4"},
+		},
+		{
+			name:     "Skips when there is no previous occurrence",
+			previous: `[{"iid":5,"state":"opened","labels":["recurring::weekly"]}]`,
+			want:     nil,
+		},
+		{
+			name:     "Skips issues without the template label",
+			previous: `[{"iid":3,"state":"opened","labels":["recurring::daily"]}]`,
+			want:     nil,
+		},
+		{
+			name:     "Skips issues created after the new one",
+			previous: `[{"iid":6,"state":"opened","labels":["recurring::weekly"],"created_at":"2020-01-14T09:00:00Z"}]`,
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous = tt.previous
+			closed = nil
+
+			err := closePreviousIssue(git, 1, &metadata{Template: "weekly"}, &gitlab.Issue{IID: 5, CreatedAt: &created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(closed, tt.want) {
+				t.Errorf("closePreviousIssue() closed = %v, want %v", closed, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withMentions(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		mentions    []string
+		want        string
+	}{
+		{name: "Leaves description unchanged without mentions", description: "Body\n", want: "Body\n"},
+		{name: "Appends references", description: "Body\n", mentions: []string{"alice", "@my-group/oncall"}, want: "Body\n\ncc @alice @my-group/oncall"},
+		{name: "Uses references as the whole description when empty", mentions: []string{"alice"}, want: "cc @alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withMentions(tt.description, tt.mentions); got != tt.want {
+				t.Errorf("withMentions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_dueTime(t *testing.T) {
+	var body struct {
+		Description string `json:"description"`
+		DueDate     string `json:"due_date"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string, roll bool) { ciProjectID, rollWeekendDue = id, roll }(ciProjectID, rollWeekendDue)
+	ciProjectID = "1"
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		data            *metadata
+		roll            bool
+		wantDescription string
+		wantDueDate     string
+	}{
+		{
+			name:            "Keeps only the due date by default",
+			data:            &metadata{Title: "Test Title", Description: "Body", DueIn: "30h", NextTime: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)},
+			wantDescription: "Body",
+			wantDueDate:     "2020-01-16",
+		},
+		{
+			name:            "Adds the exact due time to the description",
+			data:            &metadata{Title: "Test Title", Description: "Body", DueIn: "30h", DueTime: gitlab.Bool(true), NextTime: time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)},
+			wantDescription: "Body\n\nDue by 2020-01-16 15:00 UTC",
+			wantDueDate:     "2020-01-16",
+		},
+		{
+			name:            "Uses the time zone of the occurrence",
+			data:            &metadata{Title: "Test Title", DueIn: "2h", DueTime: gitlab.Bool(true), NextTime: time.Date(2020, 7, 15, 23, 0, 0, 0, london)},
+			wantDescription: "Due by 2020-07-16 01:00 BST",
+			wantDueDate:     "2020-07-16",
+		},
+		{
+			name:            "Rolls the due time with the due date",
+			data:            &metadata{Title: "Test Title", DueIn: "24h", DueTime: gitlab.Bool(true), NextTime: time.Date(2020, 1, 17, 17, 30, 0, 0, time.UTC)},
+			roll:            true,
+			wantDescription: "Due by 2020-01-20 17:30 UTC",
+			wantDueDate:     "2020-01-20",
+		},
+		{
+			name:            "Ignores due time without duein",
+			data:            &metadata{Title: "Test Title", Description: "Body", DueDate: "2020-01-18", DueTime: gitlab.Bool(true)},
+			wantDescription: "Body",
+			wantDueDate:     "2020-01-18",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollWeekendDue = tt.roll
+
+			_, err := createIssue(git, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body.Description != tt.wantDescription {
+				t.Errorf("createIssue() description = %q, want %q", body.Description, tt.wantDescription)
+			}
+			if body.DueDate != tt.wantDueDate {
+				t.Errorf("createIssue() due date = %v, want %v", body.DueDate, tt.wantDueDate)
+			}
+		})
+	}
+}
+
+func Test_truncateDescription(t *testing.T) {
+	tests := []struct {
+		name          string
+		description   string
+		limit         int
+		want          string
+		wantTruncated bool
+	}{
+		{name: "Leaves a short description unchanged", description: "Body", limit: 20, want: "Body"},
+		{name: "Leaves a description at the limit unchanged", description: "héllo", limit: 6, want: "héllo"},
+		{name: "Truncates a long description", description: "abcdefghijklmnopqrstuvwxyz", limit: 20, want: "abcdef…(truncated)", wantTruncated: true},
+		{name: "Does not split a multibyte character", description: "ab€€€€€€€€", limit: 20, want: "ab€…(truncated)", wantTruncated: true},
+		{name: "Does not split an emoji", description: "🙂🙂🙂🙂🙂🙂", limit: 21, want: "🙂…(truncated)", wantTruncated: true},
+		{name: "Keeps only the marker below its length", description: "abcdefghijklmnopqrstuvwxyz", limit: 5, want: "…(truncated)", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateDescription(tt.description, tt.limit)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("truncateDescription() = %q, %v, want %q, %v", got, truncated, tt.want, tt.wantTruncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateDescription() = %q, want valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func Test_createIssue_maxDescriptionBytes(t *testing.T) {
+	var description string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			description = body.Description
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string, limit int) { ciProjectID, maxDescriptionBytes = id, limit }(ciProjectID, maxDescriptionBytes)
+	ciProjectID = "1"
+	maxDescriptionBytes = 100
+
+	data := &metadata{Title: "Test Title", Template: "daily", Description: strings.Repeat("- [ ] überprüfen\n", 20), Warnings: &warningLog{}}
+
+	_, err := createIssue(git, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(description) > maxDescriptionBytes || !utf8.ValidString(description) {
+		t.Errorf("createIssue() description = %q (%d bytes), want valid UTF-8 of at most %d bytes", description, len(description), maxDescriptionBytes)
+	}
+	if !strings.Contains(description, "…(truncated)") || !strings.HasSuffix(description, occurrenceMarker(occurrenceKey(data))) {
+		t.Errorf("createIssue() description = %q, want it truncated before the occurrence key", description)
+	}
+	if len(data.Warnings.reset()) != 1 {
+		t.Errorf("createIssue() did not warn about the truncated description")
+	}
+}
+
+func Test_createIssue_useTemplate(t *testing.T) {
+	var description string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1,"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/repository/files/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("unexpected file query %v", r.URL.RawQuery)
+		}
+		if r.URL.Path != "/api/v4/projects/1/repository/files/.gitlab/issue_templates/Bug.md/raw" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"404 File Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, "## Steps to reproduce\n")
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			description = body.Description
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name        string
+		template    string
+		description string
+		want        string
+		wantErr     bool
+	}{
+		{name: "Uses the issue template as the description", template: "Bug", want: "## Steps to reproduce\n"},
+		{name: "Appends the template body to the issue template", template: "Bug", description: "Check the nightly build", want: "## Steps to reproduce\n\nCheck the nightly build"},
+		{name: "Reports a missing issue template", template: "Missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description = ""
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", Description: tt.description, UseTemplate: tt.template})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createIssue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if description != tt.want {
+				t.Errorf("createIssue() description = %q, want %q", description, tt.want)
+			}
+		})
+	}
+}
+
+func Test_stripQuickActions(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{
+			name:        "Removes quick action lines",
+			description: "Weekly review\n/assign @user\n/label ~bug\n- [ ] Review",
+			want:        "Weekly review\n- [ ] Review",
+		},
+		{
+			name:        "Keeps commands inside code blocks",
+			description: "```\n/label ~bug\n```",
+			want:        "```\n/label ~bug\n```",
+		},
+		{
+			name:        "Keeps paths and indented text",
+			description: "See /docs/runbook.md\n  /not-an-action",
+			want:        "See /docs/runbook.md\n  /not-an-action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripQuickActions(tt.description); got != tt.want {
+				t.Errorf("stripQuickActions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_createIssue_quickActions(t *testing.T) {
+	var description string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body struct {
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			description = body.Description
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name         string
+		quickActions *bool
+		want         string
+	}{
+		{name: "Passes quick actions through by default", want: "Review\n/label ~bug"},
+		{name: "Passes quick actions through when enabled", quickActions: gitlab.Bool(true), want: "Review\n/label ~bug"},
+		{name: "Strips quick actions when disabled", quickActions: gitlab.Bool(false), want: "Review"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description = ""
+
+			_, err := createIssue(git, &metadata{Title: "Test Title", Description: "Review\n/label ~bug", QuickActions: tt.quickActions})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if description != tt.want {
+				t.Errorf("createIssue() description = %q, want %q", description, tt.want)
+			}
+		})
+	}
+}
+
+func Test_uncheckedItems(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        []string
+	}{
+		{
+			name: "Extracts unchecked items",
+			description: `Weekly checklist
+
+- [x] Done
+- [ ] Not done
+* [ ] Also not done
+  - [ ]   Nested item
+- [X] Also done
+-[ ] Not a task`,
+			want: []string{"- [ ] Not done", "- [ ] Also not done", "- [ ] Nested item"},
+		},
+		{
+			name:        "Ignores items in code blocks",
+			description: "- [ ] Real item\n```markdown\n- [ ] Example item\n```\n",
+			want:        []string{"- [ ] Real item"},
+		},
+		{
+			name:        "Returns nothing without items",
+			description: "All done",
+			want:        nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uncheckedItems(tt.description); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uncheckedItems() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withCarriedOverItems(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		items       []string
+		want        string
+	}{
+		{name: "Leaves description without items", description: "Checklist\n", want: "Checklist\n"},
+		{name: "Appends items under a heading", description: "Checklist\n", items: []string{"- [ ] Not done"}, want: "Checklist\n\n## Carried over\n\n- [ ] Not done"},
+		{name: "Uses items as empty description", items: []string{"- [ ] Not done"}, want: "## Carried over\n\n- [ ] Not done"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withCarriedOverItems(tt.description, tt.items); got != tt.want {
+				t.Errorf("withCarriedOverItems() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_previousUncheckedItems(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "closed" || r.URL.Query().Get("labels") != "recurring::weekly" {
+			t.Errorf("unexpected issue query %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `[{"iid":4,"description":"- [x] Done\n- [ ] Not done"}]`)
+	})
+	git := newTestClient(t, mux)
+
+	got, err := previousUncheckedItems(git, 1, &metadata{Template: "weekly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"- [ ] Not done"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("previousUncheckedItems() = %v, want %v", got, want)
+	}
+}
+
+func Test_occurrenceKey(t *testing.T) {
+	nextTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	key := occurrenceKey(&metadata{Template: "weekly/report", NextTime: nextTime})
+
+	if len(key) != 16 {
+		t.Errorf("occurrenceKey() = %v, want 16 hex characters", key)
+	}
+	if other := occurrenceKey(&metadata{Template: "weekly/report", NextTime: nextTime.In(time.FixedZone("UTC+1", 3600))}); other != key {
+		t.Errorf("occurrenceKey() = %v for the same instant in another zone, want %v", other, key)
+	}
+	if other := occurrenceKey(&metadata{Template: "weekly/report", NextTime: nextTime.AddDate(0, 0, 7)}); other == key {
+		t.Errorf("occurrenceKey() = %v for a different occurrence, want a different key", other)
+	}
+	if other := occurrenceKey(&metadata{Template: "weekly/other", NextTime: nextTime}); other == key {
+		t.Errorf("occurrenceKey() = %v for a different template, want a different key", other)
+	}
+}
+
+func Test_hasOccurrenceKey(t *testing.T) {
+	key := "0123456789abcdef"
+
+	tests := []struct {
+		name   string
+		issues string
+		want   bool
+	}{
+		{name: "Finds issue with the marker", issues: `[{"iid":1,"description":"Checklist\n\n<!-- recurring-issues-key: 0123456789abcdef -->"}]`, want: true},
+		{name: "Ignores issues mentioning the key without the marker", issues: `[{"iid":1,"description":"0123456789abcdef"}]`, want: false},
+		{name: "Returns false without matches", issues: `[]`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("search") != key || r.URL.Query().Get("in") != "description" {
+					t.Errorf("unexpected issue query %v", r.URL.RawQuery)
+				}
+				fmt.Fprint(w, tt.issues)
+			})
+			git := newTestClient(t, mux)
+
+			got, err := hasOccurrenceKey(git, 1, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("hasOccurrenceKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		userStatus  int
+		tokenStatus int
+		token       string
+		dryRun      bool
+		wantErr     string
+	}{
+		{name: "Accepts a token with the api scope", userStatus: http.StatusOK, tokenStatus: http.StatusOK, token: `{"scopes":["api"]}`},
+		{name: "Rejects a token without the api scope", userStatus: http.StatusOK, tokenStatus: http.StatusOK, token: `{"scopes":["read_api"]}`, wantErr: "'api' scope"},
+		{name: "Accepts a read-only token in a dry run", userStatus: http.StatusOK, tokenStatus: http.StatusOK, token: `{"scopes":["read_api"]}`, dryRun: true},
+		{name: "Rejects a token without read access in a dry run", userStatus: http.StatusOK, tokenStatus: http.StatusOK, token: `{"scopes":["read_user"]}`, dryRun: true, wantErr: "'read_api' scope"},
+		{name: "Rejects an invalid token", userStatus: http.StatusUnauthorized, wantErr: "rejected"},
+		{name: "Accepts a token whose scopes cannot be read", userStatus: http.StatusOK, tokenStatus: http.StatusNotFound, token: `{"message":"404 Not Found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.userStatus)
+				fmt.Fprint(w, `{"id":1,"username":"bot"}`)
+			})
+			mux.HandleFunc("/api/v4/personal_access_tokens/self", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.tokenStatus)
+				fmt.Fprint(w, tt.token)
+			})
+			git := newTestClient(t, mux)
+
+			defer func(dry bool) { dryRun = dry }(dryRun)
+			dryRun = tt.dryRun
+
+			err := checkToken(git, "GITLAB_API_TOKEN")
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("checkToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkToken() error = %v, want mention of %v", err, tt.wantErr)
+			}
+		})
+	}
+}
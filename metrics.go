@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const metricsJob = "gitlab_recurring_issues"
+
+func formatMetrics(summary *runSummary, duration time.Duration) string {
+	var metrics bytes.Buffer
+
+	write := func(name string, kind string, help string, value float64) {
+		fmt.Fprintf(&metrics, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&metrics, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(&metrics, "%s %v\n", name, value)
+	}
+
+	write("issues_created_total", "counter", "Issues created by the run.", float64(len(summary.Created)))
+	write("templates_scanned", "gauge", "Templates scanned by the run.", float64(summary.TemplatesScanned))
+	write("errors_total", "counter", "Templates that failed during the run.", float64(len(summary.Errors)))
+	write("run_duration_seconds", "gauge", "Duration of the run in seconds.", duration.Seconds())
+
+	return metrics.String()
+}
+
+func pushMetrics(url string, summary *runSummary, duration time.Duration) error {
+	endpoint := strings.TrimRight(url, "/") + "/metrics/job/" + metricsJob
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, strings.NewReader(formatMetrics(summary, duration)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("pushgateway responded with %s", resp.Status)
+	}
+
+	return nil
+}
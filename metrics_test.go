@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_pushMetrics(t *testing.T) {
+	summary := newRunSummary()
+	summary.TemplatesScanned = 3
+	summary.created("daily.md", time.Time{}, nil)
+	summary.failed("broken.md", errors.New("invalid crontab"))
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "Pushes the run metrics", status: http.StatusOK},
+		{name: "Reports pushgateway failures", status: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut {
+					t.Errorf("pushMetrics() method = %v, want PUT", r.Method)
+				}
+				if r.URL.Path != "/metrics/job/gitlab_recurring_issues" {
+					t.Errorf("pushMetrics() path = %v, want /metrics/job/gitlab_recurring_issues", r.URL.Path)
+				}
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = string(body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := pushMetrics(server.URL+"/", summary, 1500*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("pushMetrics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for _, want := range []string{
+				"issues_created_total 1\n",
+				"templates_scanned 3\n",
+				"errors_total 1\n",
+				"run_duration_seconds 1.5\n",
+			} {
+				if !strings.Contains(got, want) {
+					t.Errorf("pushMetrics() body = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+type notification struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Template string `json:"template"`
+}
+
+func notifyWebhook(url string, data *metadata, issue *gitlab.Issue) error {
+	payload, err := json.Marshal(notification{
+		Title:    issue.Title,
+		URL:      issue.WebURL,
+		Template: data.Template,
+	})
+	if err != nil {
+		return err
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
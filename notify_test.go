@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func Test_notifyWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "Posts the issue details", status: http.StatusOK},
+		{name: "Reports webhook failures", status: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got notification
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("notifyWebhook() Content-Type = %v, want application/json", r.Header.Get("Content-Type"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			issue := &gitlab.Issue{Title: "Weekly report", WebURL: "https://gitlab.example.com/group/project/-/issues/1"}
+
+			err := notifyWebhook(server.URL, &metadata{Template: "weekly/report"}, issue)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("notifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			want := notification{Title: "Weekly report", URL: "https://gitlab.example.com/group/project/-/issues/1", Template: "weekly/report"}
+			if got != want {
+				t.Errorf("notifyWebhook() payload = %v, want %v", got, want)
+			}
+		})
+	}
+}
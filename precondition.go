@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+var preconditionTimeout = 10 * time.Second
+
+// checkPrecondition reports whether a GET of url responds with the wanted
+// status, or 200 OK if status is zero.
+func checkPrecondition(url string, status int) (bool, error) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	httpClient := &http.Client{Timeout: preconditionTimeout}
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == status, nil
+}
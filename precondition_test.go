@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_checkPrecondition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deployed":
+			w.WriteHeader(http.StatusOK)
+		case "/accepted":
+			w.WriteHeader(http.StatusAccepted)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defer func(timeout time.Duration) { preconditionTimeout = timeout }(preconditionTimeout)
+	preconditionTimeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		want    bool
+		wantErr bool
+	}{
+		{name: "Passes on 200 OK by default", path: "/deployed", want: true},
+		{name: "Fails on other statuses", path: "/missing", want: false},
+		{name: "Passes on a configured status", path: "/accepted", status: http.StatusAccepted, want: true},
+		{name: "Fails when the configured status differs", path: "/deployed", status: http.StatusAccepted, want: false},
+		{name: "Reports timeouts", path: "/slow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkPrecondition(server.URL+tt.path, tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkPrecondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkPrecondition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_precondition(t *testing.T) {
+	created := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			created++
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	condition := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/deployed" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer condition.Close()
+
+	defer func(id string) { ciProjectID = id }(ciProjectID)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name       string
+		path       string
+		want       int
+		wantReason string
+	}{
+		{name: "Creates the issue when the precondition holds", path: "/deployed", want: 1},
+		{name: "Skips the issue when the precondition fails", path: "/pending", want: 0, wantReason: "precondition not met"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = 0
+			summary := newRunSummary()
+
+			dir := writeTemplates(t, map[string]string{
+				"oneshot.md": "---\ntitle: One-shot\nprecondition_url: " + condition.URL + tt.path + "\n---\n",
+			})
+
+			err := processTemplate(git, time.Now(), filepath.Join(dir, "oneshot.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != tt.want {
+				t.Errorf("processTemplate() created = %v, want %v", created, tt.want)
+			}
+			if tt.wantReason != "" && (len(summary.Skipped) != 1 || summary.Skipped[0].Reason != tt.wantReason) {
+				t.Errorf("processTemplate() skipped = %v, want %v", summary.Skipped, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_processTemplate_preconditionStrict(t *testing.T) {
+	created := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			created++
+			fmt.Fprint(w, `{"id":1,"iid":1}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	git := newTestClient(t, mux)
+
+	// A closed server refuses connections, so the precondition cannot be checked
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	defer func(id string, enabled bool) { ciProjectID, strict = id, enabled }(ciProjectID, strict)
+	ciProjectID = "1"
+
+	tests := []struct {
+		name       string
+		strict     bool
+		crontab    string
+		wantErrors int
+	}{
+		{name: "Skips a one-shot issue whose precondition cannot be checked", strict: false},
+		{name: "Fails a one-shot issue whose precondition cannot be checked under STRICT", strict: true, wantErrors: 1},
+		{name: "Skips an occurrence whose precondition cannot be checked", strict: false, crontab: "@daily"},
+		{name: "Fails an occurrence whose precondition cannot be checked under STRICT", strict: true, crontab: "@daily", wantErrors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = 0
+			strict = tt.strict
+			summary := newRunSummary()
+
+			template := "---\ntitle: Checked\nprecondition_url: " + unreachable.URL + "\n"
+			if tt.crontab != "" {
+				template += "crontab: \"" + tt.crontab + "\"\n"
+			}
+
+			dir := writeTemplates(t, map[string]string{"checked.md": template + "---\n"})
+
+			err := processTemplate(git, time.Now().AddDate(0, 0, -1), filepath.Join(dir, "checked.md"), newDefaultsLoader(), summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created != 0 {
+				t.Errorf("processTemplate() created = %v, want 0", created)
+			}
+			if len(summary.Skipped) != 1 || summary.Skipped[0].Reason != "precondition not met" {
+				t.Errorf("processTemplate() skipped = %v, want precondition not met", summary.Skipped)
+			}
+			if len(summary.Errors) != tt.wantErrors {
+				t.Errorf("processTemplate() errors = %v, want %v", summary.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func runPreview(projectDir string, count int) int {
+	dir, err := resolveTemplatesDir(projectDir, issuesRelativePath)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	issuesRelativePath = dir
+
+	err = previewTemplates(os.Stdout, dir, count, time.Now())
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	return exitOK
+}
+
+func previewTemplates(w io.Writer, dir string, count int, from time.Time) error {
+	defaults := newDefaultsLoader()
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		occurrences, err := previewTemplate(path, defaults, count, from)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if occurrences == nil {
+			return nil
+		}
+
+		fmt.Fprintf(w, "%s:\n", templateName(path))
+		for _, occurrence := range occurrences {
+			fmt.Fprintf(w, "  %s\n", occurrence.Format(time.RFC3339))
+		}
+
+		return nil
+	})
+}
+
+func previewTemplate(path string, defaults *defaultsLoader, count int, from time.Time) ([]time.Time, error) {
+	data, err := loadTemplate(path, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	if !boolValue(data.Enabled, true) || len(data.Crontab) == 0 {
+		return nil, nil
+	}
+
+	occurrences := []time.Time{}
+
+	err = scheduleIssue(data, from)
+	for i := 0; i < count && err == nil && !data.NextTime.IsZero(); i++ {
+		occurrences = append(occurrences, data.NextTime)
+		err = scheduleIssue(data, data.NextTime)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return occurrences, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_previewTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"daily.md": `---
+title: Daily
+crontab: "0 9 * * *"
+---
+`,
+		"disabled.md": `---
+title: Disabled
+crontab: "@daily"
+enabled: false
+---
+`,
+		"weekly/report.md": `---
+title: Report
+crontab: "0 9 * * 1"
+timezone: "Europe/London"
+---
+`,
+	})
+
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = dir
+
+	var buffer bytes.Buffer
+
+	err := previewTemplates(&buffer, dir, 2, time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `daily:
+  2020-01-16T09:00:00Z
+  2020-01-17T09:00:00Z
+weekly/report:
+  2020-01-20T09:00:00Z
+  2020-01-27T09:00:00Z
+`
+	if buffer.String() != want {
+		t.Errorf("previewTemplates() = %v, want %v", buffer.String(), want)
+	}
+}
+
+func Test_previewTemplates_scheduleEnvironment(t *testing.T) {
+	defer func(month int, anchor time.Time, dates map[string]bool) {
+		fiscalYearStart, biweeklyAnchor, holidays = month, anchor, dates
+	}(fiscalYearStart, biweeklyAnchor, holidays)
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		holidays string
+		crontab  string
+		want     string
+	}{
+		{
+			name:    "Uses FISCAL_YEAR_START",
+			env:     map[string]string{"FISCAL_YEAR_START": "2"},
+			crontab: "@fiscal-quarter-start",
+			want:    "2026-11-02T00:00:00Z\n  2027-02-01T00:00:00Z",
+		},
+		{
+			name:    "Uses BIWEEKLY_ANCHOR",
+			env:     map[string]string{"BIWEEKLY_ANCHOR": "2026-10-14"},
+			crontab: "@biweekly",
+			want:    "2026-10-28T00:00:00Z\n  2026-11-11T00:00:00Z",
+		},
+		{
+			name:     "Uses HOLIDAYS_FILE",
+			env:      map[string]string{"FISCAL_YEAR_START": "2"},
+			holidays: "2026-11-02\n",
+			crontab:  "@fiscal-quarter-start",
+			want:     "2026-11-03T00:00:00Z\n  2027-02-01T00:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTemplates(t, map[string]string{
+				"scheduled.md": "---\ntitle: Scheduled\ncrontab: \"" + tt.crontab + "\"\n---\n",
+			})
+
+			defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+			issuesRelativePath = dir
+
+			env := map[string]string{"HOLIDAYS_FILE": ""}
+			if tt.holidays != "" {
+				env["HOLIDAYS_FILE"] = filepath.Join(writeTemplates(t, map[string]string{"holidays.txt": tt.holidays}), "holidays.txt")
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setEnv(t, env)
+			holidays = nil
+
+			err := loadScheduleEnvironment()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer bytes.Buffer
+
+			err = previewTemplates(&buffer, dir, 2, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "scheduled:\n  " + tt.want + "\n"
+			if buffer.String() != want {
+				t.Errorf("previewTemplates() = %v, want %v", buffer.String(), want)
+			}
+		})
+	}
+}
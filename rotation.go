@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const onCallAssignee = "@oncall"
+
+type rotation struct {
+	Start   string   `yaml:"start"`
+	Weeks   int      `yaml:"weeks"`
+	Members []string `yaml:"members"`
+	start   time.Time
+}
+
+func loadRotation(path string) (*rotation, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r rotation
+	err = yaml.UnmarshalStrict(contents, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	r.start, err = time.Parse("2006-01-02", r.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start %q: expected YYYY-MM-DD", r.Start)
+	}
+
+	if r.Weeks == 0 {
+		r.Weeks = 1
+	}
+	if r.Weeks < 0 {
+		return nil, errors.New("weeks must be a positive number")
+	}
+
+	if len(r.Members) == 0 {
+		return nil, errors.New("members must list at least one username")
+	}
+
+	return &r, nil
+}
+
+// onCall returns the member whose shift covers the given time. Shifts are
+// counted in whole days from the start date, in the time's own location.
+func (r *rotation) onCall(at time.Time) (string, error) {
+	year, month, day := at.Date()
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	if date.Before(r.start) {
+		return "", fmt.Errorf("%s is before the rotation starts on %s", date.Format("2006-01-02"), r.Start)
+	}
+
+	days := int(date.Sub(r.start).Hours() / 24)
+	shift := days / (7 * r.Weeks)
+
+	return r.Members[shift%len(r.Members)], nil
+}
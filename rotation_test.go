@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_loadRotation(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"rotation.yaml": `start: "2020-01-06"
+weeks: 2
+members: ["alice", "bob", "carol"]
+`,
+		"empty.yaml": `start: "2020-01-06"
+`,
+		"unknown.yaml": `start: "2020-01-06"
+member: ["alice"]
+`,
+		"invalid.yaml": `start: "next monday"
+members: ["alice"]
+`,
+	})
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{name: "Loads rotation", file: "rotation.yaml"},
+		{name: "Rejects rotation without members", file: "empty.yaml", wantErr: true},
+		{name: "Rejects unknown keys", file: "unknown.yaml", wantErr: true},
+		{name: "Rejects invalid start date", file: "invalid.yaml", wantErr: true},
+		{name: "Rejects missing file", file: "missing.yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadRotation(filepath.Join(dir, tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadRotation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_rotation_onCall(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"rotation.yaml": `start: "2020-01-06"
+weeks: 2
+members: ["alice", "bob", "carol"]
+`,
+	})
+
+	r, err := loadRotation(filepath.Join(dir, "rotation.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		want    string
+		wantErr bool
+	}{
+		{name: "Starts with the first member", at: time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC), want: "alice"},
+		{name: "Keeps the member for the whole shift", at: time.Date(2020, 1, 19, 23, 0, 0, 0, time.UTC), want: "alice"},
+		{name: "Finds the member mid-rotation", at: time.Date(2020, 1, 29, 9, 0, 0, 0, time.UTC), want: "bob"},
+		{name: "Wraps around to the first member", at: time.Date(2020, 2, 17, 9, 0, 0, 0, time.UTC), want: "alice"},
+		{name: "Uses the date in the time's location", at: time.Date(2020, 2, 3, 0, 30, 0, 0, time.FixedZone("UTC+1", 3600)), want: "carol"},
+		{name: "Rejects dates before the start", at: time.Date(2020, 1, 5, 9, 0, 0, 0, time.UTC), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.onCall(tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("onCall() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("onCall() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
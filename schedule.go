@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+)
+
+type schedule interface {
+	Next(from time.Time) time.Time
+}
+
+type fiscalQuarterSchedule struct {
+	startMonth time.Month
+}
+
+// biweeklySchedule falls at midnight every other week, counting in fortnights
+// from the anchor date, so the anchor also picks the day of the week.
+type biweeklySchedule struct {
+	anchor time.Time
+}
+
+// isoWeekSchedule falls at midnight on the Monday of every odd or even ISO
+// 8601 week. Week 53 and the following week 1 are both odd, so odd weeks run
+// on consecutive Mondays across such a year boundary.
+type isoWeekSchedule struct {
+	odd bool
+}
+
+func parseSchedule(crontab string) (schedule, error) {
+	switch crontab {
+	case "@quarterly":
+		return cronexpr.Parse("0 0 1 1,4,7,10 *")
+	case "@fiscal-quarter-start":
+		return fiscalQuarterSchedule{startMonth: time.Month(fiscalYearStart)}, nil
+	case "@biweekly":
+		return biweeklySchedule{anchor: biweeklyAnchor}, nil
+	case "@isoweek-odd":
+		return isoWeekSchedule{odd: true}, nil
+	case "@isoweek-even":
+		return isoWeekSchedule{odd: false}, nil
+	}
+
+	if strings.HasPrefix(crontab, "@") {
+		return cronexpr.Parse(crontab)
+	}
+
+	// cronexpr reads six fields as minutes through years, but a six field
+	// crontab is almost always written with a leading seconds field, so
+	// accept only five fields, or six with seconds, and say which is which.
+	fields := strings.Fields(crontab)
+	switch len(fields) {
+	case 5:
+		return cronexpr.Parse(strings.Join(fields, " "))
+	case 6:
+		return cronexpr.Parse(strings.Join(fields, " ") + " *")
+	}
+
+	return nil, fmt.Errorf("expected 5 fields, or 6 with leading seconds, got %d", len(fields))
+}
+
+func (s fiscalQuarterSchedule) Next(from time.Time) time.Time {
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+
+	for i := 0; i <= 12; i++ {
+		candidate := month.AddDate(0, i, 0)
+		if (int(candidate.Month())-int(s.startMonth)+12)%3 != 0 {
+			continue
+		}
+
+		for !isBusinessDay(candidate) {
+			candidate = candidate.AddDate(0, 0, 1)
+		}
+
+		if candidate.After(from) {
+			return candidate
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s biweeklySchedule) Next(from time.Time) time.Time {
+	anchor := time.Date(s.anchor.Year(), s.anchor.Month(), s.anchor.Day(), 0, 0, 0, 0, from.Location())
+
+	// Count whole days between the calendar dates, as days in the template's
+	// time zone are not always 24 hours long.
+	days := int(civilDate(from).Sub(civilDate(anchor)).Hours() / 24)
+	fortnights := days / 14
+	if days < 0 && days%14 != 0 {
+		fortnights--
+	}
+
+	candidate := anchor.AddDate(0, 0, fortnights*14)
+	for !candidate.After(from) {
+		candidate = candidate.AddDate(0, 0, 14)
+	}
+
+	return candidate
+}
+
+func (s isoWeekSchedule) Next(from time.Time) time.Time {
+	monday := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	monday = monday.AddDate(0, 0, -(int(monday.Weekday())+6)%7)
+
+	for {
+		_, week := monday.ISOWeek()
+		if monday.After(from) && (week%2 == 1) == s.odd {
+			return monday
+		}
+
+		monday = monday.AddDate(0, 0, 7)
+	}
+}
+
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func isBusinessDay(day time.Time) bool {
+	return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday && !holidays[day.Format("2006-01-02")]
+}
+
+func parseJitter(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	jitter, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid jitter %q: %w", value, err)
+	}
+
+	if jitter < 0 {
+		return 0, fmt.Errorf("invalid jitter %q: must not be negative", value)
+	}
+
+	return jitter, nil
+}
+
+// jitterOffset returns an offset within [0, jitter) seeded by the template
+// path, so a template is always shifted by the same amount between runs.
+func jitterOffset(template string, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(template))
+
+	return time.Duration(hash.Sum64() % uint64(jitter))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseSchedule(t *testing.T) {
+	defer func(month int) { fiscalYearStart = month }(fiscalYearStart)
+
+	tests := []struct {
+		name            string
+		crontab         string
+		fiscalYearStart int
+		from            time.Time
+		want            time.Time
+		wantErr         bool
+	}{
+		{
+			name:    "Parses crontab",
+			crontab: "0 9 * * 1",
+			from:    time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Parses quarterly",
+			crontab: "@quarterly",
+			from:    time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:            "Finds first business day of the next fiscal quarter",
+			crontab:         "@fiscal-quarter-start",
+			fiscalYearStart: 4,
+			from:            time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC),
+			want:            time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:            "Skips weekends at the start of a fiscal quarter",
+			crontab:         "@fiscal-quarter-start",
+			fiscalYearStart: 2,
+			from:            time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:            time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:            "Moves to the next quarter once the first business day has passed",
+			crontab:         "@fiscal-quarter-start",
+			fiscalYearStart: 1,
+			from:            time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:            time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Parses six fields with leading seconds",
+			crontab: "30 0 9 * * 1",
+			from:    time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 1, 20, 9, 0, 30, 0, time.UTC),
+		},
+		{
+			name:    "Ignores extra whitespace between fields",
+			crontab: "0  9 * *\t1",
+			from:    time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Rejects too few fields",
+			crontab: "0 9 * *",
+			wantErr: true,
+		},
+		{
+			name:    "Rejects too many fields",
+			crontab: "0 0 9 * * 1 2020",
+			wantErr: true,
+		},
+		{
+			name:    "Rejects invalid crontab",
+			crontab: "not a crontab",
+			wantErr: true,
+		},
+		{
+			name:    "Rejects invalid field values",
+			crontab: "0 25 * * *",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fiscalYearStart = tt.fiscalYearStart
+
+			got, err := parseSchedule(tt.crontab)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if next := got.Next(tt.from); !next.Equal(tt.want) {
+				t.Errorf("parseSchedule().Next() = %v, want %v", next, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jitterOffset(t *testing.T) {
+	jitter := 30 * time.Minute
+
+	offset := jitterOffset("weekly/standup", jitter)
+	if offset < 0 || offset >= jitter {
+		t.Errorf("jitterOffset() = %v, want within [0, %v)", offset, jitter)
+	}
+	if again := jitterOffset("weekly/standup", jitter); again != offset {
+		t.Errorf("jitterOffset() = %v on a second call, want %v", again, offset)
+	}
+	if got := jitterOffset("weekly/standup", 0); got != 0 {
+		t.Errorf("jitterOffset() = %v without jitter, want 0", got)
+	}
+}
+
+func Test_scheduleIssue_jitterWindow(t *testing.T) {
+	data := &metadata{Crontab: crontabs{"0 9 * * *"}, Jitter: "1h", Template: "daily"}
+	offset := jitterOffset(data.Template, time.Hour)
+	slot := time.Date(2020, 7, 2, 9, 0, 0, 0, time.UTC)
+
+	// A run between the cron slot and its jittered time must still find
+	// the jittered occurrence rather than skipping to the next day.
+	err := scheduleIssue(data, slot.Add(offset/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := slot.Add(offset); !data.NextTime.Equal(want) {
+		t.Errorf("scheduleIssue() NextTime = %v, want %v", data.NextTime, want)
+	}
+	if want := slot.AddDate(0, 0, 1).Add(offset); !data.PeriodEnd.Equal(want) {
+		t.Errorf("scheduleIssue() PeriodEnd = %v, want %v", data.PeriodEnd, want)
+	}
+}
+
+func Test_biweeklySchedule_Next(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		anchor time.Time
+		from   time.Time
+		want   time.Time
+	}{
+		{
+			name:   "Runs two weeks after the anchor",
+			anchor: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC),
+			from:   time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "Counts back from an anchor in the future",
+			anchor: time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC),
+			from:   time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2020, 12, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "Crosses the year boundary",
+			anchor: time.Date(2020, 12, 21, 0, 0, 0, 0, time.UTC),
+			from:   time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "Keeps to midnight across a daylight saving change",
+			anchor: time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC),
+			from:   time.Date(2021, 3, 20, 12, 0, 0, 0, london),
+			want:   time.Date(2021, 3, 29, 0, 0, 0, 0, london),
+		},
+		{
+			name:   "Uses the default anchor",
+			anchor: time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC),
+			from:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (biweeklySchedule{anchor: tt.anchor}).Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isoWeekSchedule_Next(t *testing.T) {
+	tests := []struct {
+		name    string
+		crontab string
+		from    time.Time
+		want    time.Time
+	}{
+		{
+			name:    "Runs on the Monday of the next odd week",
+			crontab: "@isoweek-odd",
+			from:    time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 1, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Runs on the Monday of the next even week",
+			crontab: "@isoweek-even",
+			from:    time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Runs in week 53",
+			crontab: "@isoweek-odd",
+			from:    time.Date(2020, 12, 22, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Runs in week 1 straight after week 53",
+			crontab: "@isoweek-odd",
+			from:    time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Skips weeks 53 and 1 for even weeks",
+			crontab: "@isoweek-even",
+			from:    time.Date(2020, 12, 22, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Runs in week 1 when it starts in December",
+			crontab: "@isoweek-odd",
+			from:    time.Date(2025, 12, 23, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Runs in week 2 after a week 1 starting in December",
+			crontab: "@isoweek-even",
+			from:    time.Date(2025, 12, 23, 0, 0, 0, 0, time.UTC),
+			want:    time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseSchedule(tt.crontab)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// fetchTemplates downloads the templates directory at ref from the
+// repository into a temporary directory, so templates can be processed as
+// they exist on another branch. The caller removes the directory.
+func fetchTemplates(git *client, projectID string, dir string, ref string) (string, error) {
+	if filepath.IsAbs(dir) {
+		return "", errors.New("TEMPLATES_DIR must be relative to the repository root when TEMPLATES_SOURCE is 'api'")
+	}
+
+	dir = path.Clean(filepath.ToSlash(dir))
+
+	tmp, err := ioutil.TempDir("", "recurring-issues")
+	if err != nil {
+		return "", err
+	}
+
+	options := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100},
+		Path:        gitlab.String(dir),
+		Ref:         gitlab.String(ref),
+		Recursive:   gitlab.Bool(true),
+	}
+
+	for {
+		var nodes []*gitlab.TreeNode
+		var resp *gitlab.Response
+		err := withRetry(func() (*gitlab.Response, error) {
+			var err error
+			nodes, resp, err = git.Repositories.ListTree(projectID, options)
+			return resp, err
+		})
+		if err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+
+		for _, node := range nodes {
+			if node.Type != "blob" || !strings.HasPrefix(node.Path, dir+"/") {
+				continue
+			}
+
+			err := fetchTemplateFile(git, projectID, node.Path, ref, filepath.Join(tmp, filepath.FromSlash(strings.TrimPrefix(node.Path, dir+"/"))))
+			if err != nil {
+				os.RemoveAll(tmp)
+				return "", err
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		options.Page = resp.NextPage
+	}
+
+	log.Println("Fetched templates from", dir, "at", ref)
+
+	return tmp, nil
+}
+
+func fetchTemplateFile(git *client, projectID string, file string, ref string, destination string) error {
+	var contents []byte
+	err := withRetry(func() (resp *gitlab.Response, err error) {
+		contents, resp, err = git.RepositoryFiles.GetRawFile(projectID, file, &gitlab.GetRawFileOptions{Ref: gitlab.String(ref)})
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(destination, contents, 0644)
+}
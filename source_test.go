@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_fetchTemplates(t *testing.T) {
+	files := map[string]string{
+		".gitlab/recurring_issue_templates/daily.md":            "---\ntitle: Daily\n---\n",
+		".gitlab/recurring_issue_templates/team/weekly.md":      "---\ntitle: Weekly\n---\n",
+		".gitlab/recurring_issue_templates/team/_defaults.yaml": "labels: [team]\n",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/1/repository/tree", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" || r.URL.Query().Get("path") != ".gitlab/recurring_issue_templates" || r.URL.Query().Get("recursive") != "true" {
+			t.Errorf("unexpected tree query %v", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"type":"blob","path":".gitlab/recurring_issue_templates/team/weekly.md"},{"type":"blob","path":".gitlab/recurring_issue_templates/team/_defaults.yaml"}]`)
+			return
+		}
+		w.Header().Set("X-Next-Page", "2")
+		fmt.Fprint(w, `[{"type":"blob","path":".gitlab/recurring_issue_templates/daily.md"},{"type":"tree","path":".gitlab/recurring_issue_templates/team"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/repository/files/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("unexpected file query %v", r.URL.RawQuery)
+		}
+		file := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v4/projects/1/repository/files/"), "/raw")
+		contents, ok := files[file]
+		if !ok {
+			t.Errorf("unexpected file %v", file)
+		}
+		fmt.Fprint(w, contents)
+	})
+	git := newTestClient(t, mux)
+
+	dir, err := fetchTemplates(git, "1", ".gitlab/recurring_issue_templates/", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, strings.TrimPrefix(file, ".gitlab/recurring_issue_templates/")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("fetchTemplates() %v = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func Test_fetchTemplates_absoluteDir(t *testing.T) {
+	_, err := fetchTemplates(nil, "1", "/templates", "main")
+	if err == nil {
+		t.Errorf("fetchTemplates() error = nil, want an error for an absolute directory")
+	}
+}
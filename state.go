@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+type runState struct {
+	LastRun   time.Time            `json:"last_run"`
+	Templates map[string]time.Time `json:"templates,omitempty"`
+	updated   map[string]time.Time
+}
+
+func newRunState(lastRun time.Time) *runState {
+	return &runState{LastRun: lastRun}
+}
+
+func (s *runState) lastRunTime(template string) time.Time {
+	if lastRun, ok := s.Templates[template]; ok {
+		return lastRun
+	}
+
+	// A template missing from existing state was added since the last run, so schedule it from now
+	if len(s.Templates) > 0 {
+		return time.Now()
+	}
+
+	return s.LastRun
+}
+
+func (s *runState) recordRun(template string, runTime time.Time) {
+	if s.updated != nil {
+		s.updated[template] = runTime
+	}
+}
+
+func readStateFile(path string) (*runState, error) {
+	state := &runState{LastRun: time.Unix(0, 0), updated: make(map[string]time.Time)}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(contents, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *runState) write(path string, runTime time.Time) error {
+	state := runState{LastRun: runTime, Templates: make(map[string]time.Time)}
+	for template, lastRun := range s.Templates {
+		state.Templates[template] = lastRun
+	}
+	for template, lastRun := range s.updated {
+		state.Templates[template] = lastRun
+	}
+
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, contents, 0644)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_stateFile(t *testing.T) {
+	path := filepath.Join(writeTemplates(t, map[string]string{}), "state.json")
+
+	state, err := readStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.LastRun.Equal(time.Unix(0, 0)) {
+		t.Errorf("readStateFile() LastRun = %v, want the epoch for a missing file", state.LastRun)
+	}
+
+	runTime := time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC)
+	state.recordRun("daily", runTime)
+
+	err = state.write(path, runTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = readStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.LastRun.Equal(runTime) || !state.Templates["daily"].Equal(runTime) {
+		t.Errorf("readStateFile() = %+v, want last run %v for daily", state, runTime)
+	}
+}
+
+func Test_runState_lastRunTime(t *testing.T) {
+	lastRun := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+	recorded := time.Date(2020, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		state    *runState
+		template string
+		want     func(time.Time) bool
+	}{
+		{
+			name:     "Uses global last run without per-template state",
+			state:    newRunState(lastRun),
+			template: "daily",
+			want:     func(got time.Time) bool { return got.Equal(lastRun) },
+		},
+		{
+			name:     "Uses the template's own last run",
+			state:    &runState{LastRun: lastRun, Templates: map[string]time.Time{"daily": recorded}},
+			template: "daily",
+			want:     func(got time.Time) bool { return got.Equal(recorded) },
+		},
+		{
+			name:     "Schedules new templates from now",
+			state:    &runState{LastRun: lastRun, Templates: map[string]time.Time{"daily": recorded}},
+			template: "monthly",
+			want:     func(got time.Time) bool { return time.Since(got) < time.Minute },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.lastRunTime(tt.template); !tt.want(got) {
+				t.Errorf("runState.lastRunTime() = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+type summaryEntry struct {
+	Path     string     `json:"path"`
+	NextTime *time.Time `json:"next_time,omitempty"`
+	IID      int        `json:"iid,omitempty"`
+	URL      string     `json:"url,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// createdIssue is an entry in the created issues artifact. Its fields are
+// read by downstream jobs, so they must not be renamed or removed.
+type createdIssue struct {
+	IID      int    `json:"iid"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Template string `json:"template"`
+}
+
+type runSummary struct {
+	TemplatesScanned int            `json:"templates_scanned"`
+	Created          []summaryEntry `json:"created"`
+	Skipped          []summaryEntry `json:"skipped"`
+	Errors           []summaryEntry `json:"errors"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		Created: []summaryEntry{},
+		Skipped: []summaryEntry{},
+		Errors:  []summaryEntry{},
+	}
+}
+
+func (s *runSummary) created(path string, nextTime time.Time, issue *gitlab.Issue) {
+	entry := summaryEntry{Path: path, NextTime: timePointer(nextTime)}
+	if issue != nil {
+		entry.IID, entry.URL, entry.Title = issue.IID, issue.WebURL, issue.Title
+	}
+
+	s.Created = append(s.Created, entry)
+}
+
+func (s *runSummary) skipped(path string, nextTime time.Time, reason string) {
+	s.Skipped = append(s.Skipped, summaryEntry{Path: path, NextTime: timePointer(nextTime), Reason: reason})
+}
+
+func (s *runSummary) failed(path string, err error) {
+	s.Errors = append(s.Errors, summaryEntry{Path: path, Error: err.Error()})
+}
+
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func (s *runSummary) write(path string) error {
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+func (s *runSummary) merge(other *runSummary) {
+	s.TemplatesScanned += other.TemplatesScanned
+	s.Created = append(s.Created, other.Created...)
+	s.Skipped = append(s.Skipped, other.Skipped...)
+	s.Errors = append(s.Errors, other.Errors...)
+}
+
+// writeArtifact writes the issues created during the run, leaving out
+// entries without an issue such as those from a dry run.
+func (s *runSummary) writeArtifact(path string) error {
+	issues := []createdIssue{}
+	for _, entry := range s.Created {
+		if entry.IID == 0 {
+			continue
+		}
+
+		issues = append(issues, createdIssue{IID: entry.IID, URL: entry.URL, Title: entry.Title, Template: templateName(entry.Path)})
+	}
+
+	contents, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, contents, 0644)
+}
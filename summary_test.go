@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func Test_runSummary_write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nextTime := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	summary := newRunSummary()
+	summary.TemplatesScanned = 3
+	summary.created("daily.md", nextTime, nil)
+	summary.skipped("weekly.md", nextTime, "not due")
+	summary.failed("broken.md", errors.New("syntax error"))
+
+	path := filepath.Join(dir, "summary.json")
+
+	err = summary.write(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+  "templates_scanned": 3,
+  "created": [
+    {
+      "path": "daily.md",
+      "next_time": "2020-01-01T09:00:00Z"
+    }
+  ],
+  "skipped": [
+    {
+      "path": "weekly.md",
+      "next_time": "2020-01-01T09:00:00Z",
+      "reason": "not due"
+    }
+  ],
+  "errors": [
+    {
+      "path": "broken.md",
+      "error": "syntax error"
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("runSummary.write() = %v, want %v", string(got), want)
+	}
+}
+
+func Test_runSummary_writeArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { issuesRelativePath = path }(issuesRelativePath)
+	issuesRelativePath = "/templates"
+
+	nextTime := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	summary := newRunSummary()
+	summary.created("/templates/team/daily.md", nextTime, &gitlab.Issue{IID: 7, WebURL: "https://gitlab.example.com/group/project/-/issues/7", Title: "Daily"})
+	summary.created("/templates/dry-run.md", nextTime, nil)
+	summary.skipped("/templates/weekly.md", nextTime, "not due")
+
+	path := filepath.Join(dir, "created_issues.json")
+
+	err = summary.writeArtifact(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[
+  {
+    "iid": 7,
+    "url": "https://gitlab.example.com/group/project/-/issues/7",
+    "title": "Daily",
+    "template": "team/daily"
+  }
+]`
+	if string(got) != want {
+		t.Errorf("writeArtifact() = %v, want %v", string(got), want)
+	}
+
+	err = newRunSummary().writeArtifact(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "[]" {
+		t.Errorf("writeArtifact() = %v, want []", string(got))
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type validationError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e validationError) String() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func runValidation(projectDir string) int {
+	dir, err := resolveTemplatesDir(projectDir, issuesRelativePath)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitConfigError
+	}
+
+	failures, err := validateTemplates(dir)
+	if err != nil {
+		log.Println("Error:", err)
+		return exitTemplatesFailed
+	}
+
+	if len(failures) > 0 {
+		log.Println("Validation failed with", len(failures), "error(s):")
+		for _, failure := range failures {
+			log.Println(" -", failure)
+		}
+		return exitTemplatesFailed
+	}
+
+	log.Println("Validation passed")
+	return exitOK
+}
+
+func validateTemplates(dir string) ([]validationError, error) {
+	var failures []validationError
+
+	defaults := newDefaultsLoader()
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			failures = append(failures, validationError{Path: path, Err: err})
+			return nil
+		}
+
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		failures = append(failures, validateTemplate(path, defaults)...)
+		return nil
+	})
+
+	return failures, err
+}
+
+func validateTemplate(path string, defaults *defaultsLoader) []validationError {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []validationError{{Path: path, Err: err}}
+	}
+
+	data, err := parseMetadata(contents)
+	if err != nil {
+		return []validationError{{Path: path, Err: err}}
+	}
+
+	var failures []validationError
+
+	unknown, err := unknownKeys(contents)
+	if err != nil {
+		return []validationError{{Path: path, Err: err}}
+	}
+
+	for _, key := range unknown {
+		failures = append(failures, validationError{Path: path, Line: keyLine(contents, key), Err: fmt.Errorf("unknown key %q", key)})
+	}
+
+	directoryDefaults, err := defaults.load(filepath.Dir(path))
+	if err != nil {
+		return []validationError{{Path: path, Err: err}}
+	}
+
+	mergeDefaults(data, directoryDefaults)
+
+	fail := func(key string, err error) {
+		failures = append(failures, validationError{Path: path, Line: keyLine(contents, key), Err: err})
+	}
+
+	for _, crontab := range data.Crontab {
+		_, err := parseSchedule(crontab)
+		if err != nil {
+			fail("crontab", fmt.Errorf("invalid crontab %q: %w", crontab, err))
+		}
+	}
+
+	_, err = parseJitter(data.Jitter)
+	if err != nil {
+		fail("jitter", err)
+	}
+
+	_, err = time.LoadLocation(data.Timezone)
+	if err != nil {
+		fail("timezone", fmt.Errorf("invalid timezone %q: %w", data.Timezone, err))
+	}
+
+	if data.StartDate != "" {
+		_, err := parseTemplateDate(data.StartDate, "")
+		if err != nil {
+			fail("startdate", fmt.Errorf("invalid startdate: %w", err))
+		}
+	}
+
+	if data.EndDate != "" {
+		_, err := parseTemplateDate(data.EndDate, "")
+		if err != nil {
+			fail("enddate", fmt.Errorf("invalid enddate: %w", err))
+		}
+	}
+
+	if data.DueIn != "" {
+		_, err := parseDueIn(data.DueIn, time.Now())
+		if err != nil {
+			fail("duein", fmt.Errorf("invalid duein: %w", err))
+		}
+	}
+
+	if data.DueDate != "" {
+		_, err := parseDueDate(data.DueDate, time.Now())
+		if err != nil {
+			fail("duedate", err)
+		}
+	}
+
+	if data.Instance != "" && data.Project == "" {
+		fail("instance", fmt.Errorf("instance %q requires project to be set", data.Instance))
+	}
+
+	if boolValue(data.DueTime, false) && (data.DueIn == "" || data.DueDate != "") {
+		fail("duetime", errors.New("duetime requires duein without duedate"))
+	}
+
+	if data.IssueType != "" && !contains(issueTypes, data.IssueType) {
+		fail("issuetype", fmt.Errorf("invalid issuetype %q: must be one of %s", data.IssueType, strings.Join(issueTypes, ", ")))
+	}
+
+	if data.HealthStatus != "" && !contains(healthStatuses, data.HealthStatus) {
+		fail("healthstatus", fmt.Errorf("invalid healthstatus %q: must be one of %s", data.HealthStatus, strings.Join(healthStatuses, ", ")))
+	}
+
+	if data.AssigneeStrategy != "" && !contains(assigneeStrategies, data.AssigneeStrategy) {
+		fail("assignee_strategy", fmt.Errorf("invalid assignee_strategy %q: must be one of %s", data.AssigneeStrategy, strings.Join(assigneeStrategies, ", ")))
+	}
+
+	if data.AssigneeStrategy == "round-robin" && len(data.AssigneePool) == 0 {
+		fail("assignee_strategy", errors.New("assignee_strategy round-robin requires an assignee_pool"))
+	}
+
+	if data.Blocks < 0 {
+		fail("blocks", fmt.Errorf("invalid blocks %d: must be an issue IID", data.Blocks))
+	}
+
+	if data.BlockedBy < 0 {
+		fail("blockedby", fmt.Errorf("invalid blockedby %d: must be an issue IID", data.BlockedBy))
+	}
+
+	_, err = parseEstimate(data.Estimate)
+	if err != nil {
+		fail("estimate", err)
+	}
+
+	return failures
+}
+
+func keyLine(contents []byte, key string) int {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		for _, prefix := range []string{key + ":", key + " =", key + "=", `"` + key + `"`} {
+			if strings.HasPrefix(text, prefix) {
+				return line
+			}
+		}
+	}
+
+	return 0
+}
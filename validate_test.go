@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_validateTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"valid.md": `---
+title: Valid
+crontab: "@daily"
+---
+`,
+		"invalid.md": `---
+title: Invalid
+crontab: ["@daily", "not a crontab"]
+timezone: "Not/AZone"
+duein: "tomorrow"
+---
+`,
+		"oneshot.md": `---
+title: One-shot
+---
+`,
+		"toml.md": `+++
+title = "TOML"
+crontab = "@daily"
+issuetype = "bug"
++++
+`,
+		"typo.md": `---
+title: Typo
+crontab: "@daily"
+assignee: ["user1"]
+---
+`,
+	})
+
+	failures, err := validateTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		file string
+		line int
+	}{
+		{file: "invalid.md", line: 3},
+		{file: "invalid.md", line: 4},
+		{file: "invalid.md", line: 5},
+		{file: "toml.md", line: 4},
+		{file: "typo.md", line: 4},
+	}
+
+	if len(failures) != len(want) {
+		t.Fatalf("validateTemplates() = %v, want %v failures", failures, len(want))
+	}
+	for i, w := range want {
+		if filepath.Base(failures[i].Path) != w.file || failures[i].Line != w.line {
+			t.Errorf("validateTemplates() failure %d = %v, want %s:%d", i, failures[i], w.file, w.line)
+		}
+	}
+}
+
+func Test_keyLine(t *testing.T) {
+	contents := []byte(`---
+title: Test
+  crontab: "@daily"
+---
+`)
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "Finds first line", key: "title", want: 2},
+		{name: "Ignores indentation", key: "crontab", want: 3},
+		{name: "Returns zero when missing", key: "timezone", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyLine(contents, tt.key); got != tt.want {
+				t.Errorf("keyLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}